@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// retryPolicies maps the YAML's retries values to wag retry policies
+var retryPolicies = map[string]string{
+	"none":        "NoRetryPolicy",
+	"single":      "SingleRetryPolicy",
+	"exponential": "ExponentialRetryPolicy",
+}
+
+// circuitBreaker configures a wag client's circuit breaker. Unset fields keep wag's defaults; the
+// counts are pointers so that an explicit 0 is kept.
+type circuitBreaker struct {
+	Debug                  bool `yaml:"debug"`
+	MaxConcurrentRequests  *int `yaml:"maxConcurrentRequests"`
+	RequestVolumeThreshold *int `yaml:"requestVolumeThreshold"`
+	// SleepWindow is in milliseconds
+	SleepWindow           *int `yaml:"sleepWindow"`
+	ErrorPercentThreshold *int `yaml:"errorPercentThreshold"`
+}
+
+// defaults for the circuitBreaker counts, matching wag's DefaultCircuitSettings
+const (
+	defaultMaxConcurrentRequests  = 100
+	defaultRequestVolumeThreshold = 20
+	defaultSleepWindow            = 5000
+	defaultErrorPercentThreshold  = 90
+)
+
+// negative reports whether any of vs is set to a negative value
+func negative(vs ...*int) bool {
+	for _, v := range vs {
+		if v != nil && *v < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func validRetryPolicies() string {
+	names := []string{}
+	for name := range retryPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// validateClientSettings checks a dependency's timeout, retries and circuitBreaker, so mistakes are
+// caught at generation time rather than when the service starts
+func validateClientSettings(d dependency) error {
+	if d.Timeout != "" {
+		timeout, err := time.ParseDuration(d.Timeout)
+		if err != nil {
+			return fmt.Errorf("dependency %s: invalid timeout: %s", d.Name, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("dependency %s: timeout must be positive", d.Name)
+		}
+	}
+	if _, ok := retryPolicies[d.Retries]; d.Retries != "" && !ok {
+		return fmt.Errorf("dependency %s: invalid retries %q, must be one of: %s", d.Name, d.Retries, validRetryPolicies())
+	}
+	if cb := d.CircuitBreaker; cb != nil {
+		if negative(cb.MaxConcurrentRequests, cb.RequestVolumeThreshold, cb.SleepWindow) {
+			return fmt.Errorf("dependency %s: circuitBreaker values must not be negative", d.Name)
+		}
+		if p := cb.ErrorPercentThreshold; p != nil && (*p < 0 || *p > 100) {
+			return fmt.Errorf("dependency %s: circuitBreaker errorPercentThreshold must be between 0 and 100", d.Name)
+		}
+	}
+	return nil
+}
+
+// clientSettings are the wag client setter calls for a dependency's settings, e.g. .SetTimeout(5 * time.Second)
+func clientSettings(d dependency, clientPath string) []jen.Code {
+	settings := []jen.Code{}
+	if d.Timeout != "" {
+		// validated by validateClientSettings
+		timeout, _ := time.ParseDuration(d.Timeout)
+		settings = append(settings, jen.Dot("SetTimeout").Call(durationExpr(timeout)))
+	}
+	if d.Retries != "" {
+		settings = append(settings, jen.Dot("SetRetryPolicy").Call(jen.Qual(clientPath, retryPolicies[d.Retries]).Values()))
+	}
+	if cb := d.CircuitBreaker; cb != nil {
+		withDefault := func(v *int, def int) int {
+			if v == nil {
+				return def
+			}
+			return *v
+		}
+		settings = append(settings, jen.Dot("SetCircuitBreakerSettings").Call(jen.Qual(clientPath, "CircuitBreakerSettings").Values(jen.Dict{
+			jen.Id("Debug"):                  jen.Lit(cb.Debug),
+			jen.Id("MaxConcurrentRequests"):  jen.Lit(withDefault(cb.MaxConcurrentRequests, defaultMaxConcurrentRequests)),
+			jen.Id("RequestVolumeThreshold"): jen.Lit(withDefault(cb.RequestVolumeThreshold, defaultRequestVolumeThreshold)),
+			jen.Id("SleepWindow"):            jen.Lit(withDefault(cb.SleepWindow, defaultSleepWindow)),
+			jen.Id("ErrorPercentThreshold"):  jen.Lit(withDefault(cb.ErrorPercentThreshold, defaultErrorPercentThreshold)),
+		})))
+	}
+	return settings
+}
+
+// configureLines apply an initTask's client settings to the client in varName
+func configureLines(varName string, t initTask) []jen.Code {
+	lines := []jen.Code{}
+	for _, s := range t.settings {
+		lines = append(lines, jen.Id(varName).Add(s))
+	}
+	return lines
+}
@@ -1,23 +1,145 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/dave/jennifer/jen"
 )
 
-const wagClientSuffix = "/gen-go/client"
+const (
+	wagClientSuffix = "/gen-go/client"
+	// defaultClientconfigImport and defaultClientconfigFunc build the *http.Client and logger passed to NewFromDiscovery
+	defaultClientconfigImport = "github.com/Clever/wag/clientconfig/v9"
+	defaultClientconfigFunc   = "WithoutTracing"
+)
+
+// options holds the command-line settings shared by the generators
+type options struct {
+	packageName          string
+	skipDependencies     map[string]bool
+	overrideDependencies string
+	// spec emits LaunchSpec, DebugHandler and LogSummary for runtime introspection
+	spec bool
+	// dotenv makes InitLaunchConfig load .env.local when DEPLOY_ENV is "local"
+	dotenv bool
+	// flags emits RegisterFlags, so every Environment field can be overridden on the command line
+	flags bool
+	// context emits NewLaunchConfigContext, which creates dependencies concurrently under a timeout
+	context bool
+	// initTimeout is the default InitTimeout in context mode
+	initTimeout time.Duration
+	// overrides are -override values, dep:key=value,...
+	overrides []string
+	// lazy creates dependency clients on first use, and emits the MustLaunchConfig singleton
+	lazy bool
+	// logFormat routes errors that exit the program through the generated FatalLogger: text or kayvee
+	logFormat string
+	// health emits CheckHealth and HealthHandler on Dependencies
+	health bool
+	// runtimeLimits emits the container's CPU and memory from values.yaml resources, and ApplyRuntimeLimits
+	runtimeLimits bool
+	// clientconfigImport and clientconfigFunc override defaultClientconfigImport and defaultClientconfigFunc
+	clientconfigImport string
+	clientconfigFunc   string
+}
+
+// clientconfig returns the import path and function that configure wag clients
+func (o options) clientconfig() (importPath, fn string) {
+	importPath, fn = o.clientconfigImport, o.clientconfigFunc
+	if importPath == "" {
+		importPath = defaultClientconfigImport
+	}
+	if fn == "" {
+		fn = defaultClientconfigFunc
+	}
+	return importPath, fn
+}
 
 func cleverImportPath(depName, pathSuffix string) string {
 	return "github.com/Clever/" + depName + pathSuffix
 }
 
+// dependency is an entry in the YAML's dependencies list. It is either a service name, or a mapping:
+//
+//	dependencies:
+//	  - workflow-manager
+//	  - name: dapple
+//	    optional: true
+//	    timeout: 5s
+//	  - name: legacy-api
+//	    kind: http
+//	  - name: rostering
+//	    version: 2
+//	  - name: search
+//	    kind: grpc
+//	    tls: true
+type dependency struct {
+	Name string `yaml:"name"`
+	// Kind is wag (the default), http or grpc
+	Kind string `yaml:"kind"`
+	// Version is the wag client's major version. From 2 on, it is appended to the import path, e.g. /v2.
+	Version int `yaml:"version"`
+	// TLS makes a grpc dependency connect over TLS
+	TLS bool `yaml:"tls"`
+	// Optional dependencies are left nil, rather than exiting the program, if they can't be discovered
+	Optional bool `yaml:"optional"`
+	// Timeout is a Go duration, e.g. 5s, applied with the client's SetTimeout
+	Timeout string `yaml:"timeout"`
+	// Retries is the client's retry policy: none, single or exponential
+	Retries        string          `yaml:"retries"`
+	CircuitBreaker *circuitBreaker `yaml:"circuitBreaker"`
+	entryDocs      `yaml:",inline"`
+}
+
+func (d *dependency) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		d.Name = name
+		return nil
+	}
+	type plain dependency
+	if err := unmarshal((*plain)(d)); err != nil {
+		return err
+	}
+	if d.Name == "" {
+		return fmt.Errorf("dependency is missing a name")
+	}
+	if _, ok := dependencyExposes[d.kind()]; !ok {
+		return fmt.Errorf("dependency %s: invalid kind %q, must be one of: %s, %s, %s", d.Name, d.Kind, dependencyKindWag, dependencyKindHTTP, dependencyKindGRPC)
+	}
+	if d.kind() != dependencyKindWag && (d.Timeout != "" || d.Retries != "" || d.CircuitBreaker != nil || d.Version != 0) {
+		return fmt.Errorf("dependency %s: version, timeout, retries and circuitBreaker are only supported for wag dependencies", d.Name)
+	}
+	if d.TLS && d.kind() != dependencyKindGRPC {
+		return fmt.Errorf("dependency %s: tls is only supported for grpc dependencies", d.Name)
+	}
+	if d.Version < 0 {
+		return fmt.Errorf("dependency %s: version must not be negative", d.Name)
+	}
+	return validateClientSettings(*d)
+}
+
+func dependencyNames(deps []dependency) []string {
+	names := []string{}
+	for _, d := range deps {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
 type varOverride struct {
 	old string
 	new string
 }
 
+// optionalEnvVars are read with os.Getenv rather than required
+var optionalEnvVars = []string{
+	// Not used in dev
+	"TRACING_ACCESS_TOKEN",
+}
+
 var varOverrides = []varOverride{
 	{old: "Url", new: "URL"},
 	{old: "Id", new: "ID"},
@@ -69,99 +191,195 @@ func contains(many []string, one string) bool {
 	return false
 }
 
-func parseOverrideDependencies(overrideDependenciesString *string, dependencies []string) map[string]string {
-	overrideDependenciesMap := make(map[string]string)
+// initTask is a dependency client or external URL that InitLaunchConfig creates, and that can fail
+type initTask struct {
+	name    string
+	varName string
+	// kind is the dependency kind, or "" for external URLs
+	kind string
+	// clientPath is a wag dependency's client package
+	clientPath string
+	varType    jen.Code
+	// call returns the value and an error
+	call jen.Code
+	// optional tasks log a warning and record their error in DependencyStatus, rather than failing
+	optional bool
+	// settings are method calls applied to a wag client, e.g. .SetTimeout(5 * time.Second)
+	settings []jen.Code
+	// clientconfigCall and constructorCall create a wag client in its generated constructor
+	clientconfigCall jen.Code
+	constructorCall  jen.Code
+	// docs are the dependency's doc comment
+	docs entryDocs
+}
 
-	if overrideDependenciesString == nil || *overrideDependenciesString == "" {
-		return overrideDependenciesMap
+// logField is the structured log field that names the task
+func (t initTask) logField() string {
+	if t.kind == "" {
+		return "external_url"
 	}
+	return "dependency"
+}
 
-	overrideDependenciesList := strings.Split(*overrideDependenciesString, ",")
-	for _, overrideRule := range overrideDependenciesList {
-		depReplacementArr := strings.Split(overrideRule, ":")
-
-		if len(depReplacementArr) != 2 || depReplacementArr[1] == "" {
-			log.Fatal("usage: invalid formatting for the -d flag")
-		}
+// usesOptions reports whether the task's call reads initOptions
+func (t initTask) usesOptions() bool {
+	return t.kind == dependencyKindWag || t.kind == dependencyKindGRPC
+}
 
-		if !contains(dependencies, depReplacementArr[0]) {
-			log.Fatal(depReplacementArr[0], " is not a dependency specified in the provided yaml file")
+func generateDependencies(f *jen.File, deps []dependency, overrides map[string]dependencyOverride, opts options) (jen.Dict, []initTask) {
+	depTasks := dependencyInitTasks(deps, overrides, opts)
+	for _, t := range depTasks {
+		if t.clientPath != "" {
+			f.ImportAlias(t.clientPath, clientImportAlias(t.name))
 		}
-
-		overrideDependenciesMap[depReplacementArr[0]] = depReplacementArr[1]
+	}
+	if opts.lazy {
+		return emitLazyDependencies(f, depTasks), depTasks
 	}
 
-	return overrideDependenciesMap
-}
-
-func generateDependencies(f *jen.File, deps []string, skip map[string]bool, overrides map[string]string) (jen.Dict, []jen.Code) {
 	depsStruct := []jen.Code{}
 	depsInitDict := jen.Dict{}
-	for _, d := range deps {
-		if _, ok := skip[d]; ok {
-			continue
-		}
-		importPackage, pathSuffix := resolveDepImport(d, overrides)
-		depsStruct = append(depsStruct, jen.Id(toPublicVar(d)).Qual(cleverImportPath(importPackage, pathSuffix), "Client"))
-		depsInitDict[jen.Id(toPublicVar(d))] = jen.Id(toPrivateVar(d))
+	for _, t := range depTasks {
+		depsStruct = append(depsStruct, t.docs.comments()...)
+		depsStruct = append(depsStruct, jen.Id(toPublicVar(t.name)).Add(t.varType))
+		depsInitDict[jen.Id(toPublicVar(t.name))] = jen.Id(t.varName)
 	}
 	f.Comment("Dependencies has clients for the service's dependencies")
 	f.Type().Id("Dependencies").Struct(depsStruct...)
-	return depsInitDict, buildDepInitLines(deps, skip, overrides)
+	return depsInitDict, depTasks
 }
 
-func resolveDepImport(dep string, overrides map[string]string) (depName, pathSuffix string) {
-	if override, hasOverride := overrides[dep]; hasOverride {
-		return override, ""
-	}
-	return dep, wagClientSuffix
+// clientImportAlias names a wag dependency's client package after the dependency, rather than
+// leaving every client package to be numbered client, client1, ...
+// workflow-manager => workflowmanagerclient
+func clientImportAlias(dep string) string {
+	return strings.ToLower(toPublicVar(dep)) + "client"
 }
 
-func buildDepInitLines(deps []string, skip map[string]bool, overrides map[string]string) []jen.Code {
-	atLeastOneDep := false
+func dependencyInitTasks(deps []dependency, overrides map[string]dependencyOverride, opts options) []initTask {
+	tasks := []initTask{}
 	for _, d := range deps {
-		if _, skipped := skip[d]; !skipped {
-			atLeastOneDep = true
-			break
+		if _, ok := opts.skipDependencies[d.Name]; ok {
+			continue
 		}
+		tasks = append(tasks, dependencyInitTask(d, overrides, opts))
 	}
-	if !atLeastOneDep {
-		return []jen.Code{}
-	}
-
-	initLines := []jen.Code{
-		jen.Id("var exporter ").Qual("go.opentelemetry.io/otel/sdk/trace", "SpanExporter"),
-		jen.If(jen.Id("exp").Op("==").Nil().Block(
-			jen.Id("exporter").Op("=").Qual("go.opentelemetry.io/otel/sdk/trace/tracetest", "NewNoopExporter").Call(),
-		)).Else().Block(
-			jen.Id("exporter").Op("=").Id("*exp"),
-		),
-	}
+	return tasks
+}
 
-	for _, d := range deps {
-		if _, ok := skip[d]; ok {
+// buildInitLines runs each initTask in turn, exiting the program if one fails
+func buildInitLines(tasks []initTask, opts options) []jen.Code {
+	initLines := []jen.Code{}
+	for _, t := range tasks {
+		if t.optional {
+			initLines = append(initLines, optionalInitLines(t)...)
 			continue
 		}
-		depName, pathSuffix := resolveDepImport(d, overrides)
 		initLines = append(initLines, []jen.Code{
-			jen.List(jen.Id(toPrivateVar(d)), jen.Err()).Op(":=").
-				Qual(cleverImportPath(depName, pathSuffix), "NewFromDiscovery").
-				Call(jen.Qual("github.com/Clever/wag/clientconfig/v9", "WithTracing").Call(jen.Lit(d), jen.Id("exporter"))),
+			jen.List(jen.Id(t.varName), jen.Err()).Op(":=").Add(t.call),
 			jen.If(jen.Err().Op("!=").Nil()).Block(
-				jen.Qual("log", "Fatalf").Call(jen.List(jen.Lit("discovery error: %s"), jen.Err())),
+				fatalCall(opts, "discovery-error", jen.Dict{
+					jen.Lit(t.logField()): jen.Lit(t.name),
+					jen.Lit("error"):      jen.Err().Dot("Error").Call(),
+				}, "discovery error: %s", jen.Err()),
 			),
 		}...)
 	}
-
 	return initLines
 }
 
-func emitRequireEnvVar(f *jen.File) {
-	f.Comment(`requireEnvVar exits the program immediately if an env var is not set`)
+// optionalInitLines run an optional initTask, leaving its variable nil and recording the error if it fails
+func optionalInitLines(t initTask) []jen.Code {
+	return []jen.Code{
+		jen.Var().Id(t.varName).Add(t.varType),
+		jen.If(jen.List(jen.Id("c"), jen.Err()).Op(":=").Add(t.call), jen.Err().Op("!=").Nil()).Block(
+			jen.Id("o").Dot("logger").Dot("Printf").Call(jen.Lit("warning: optional dependency "+t.name+" is unavailable: %s"), jen.Err()),
+			jen.Id("DependencyStatus").Index(jen.Lit(t.name)).Op("=").Err(),
+		).Else().Block(
+			jen.Id(t.varName).Op("=").Id("c"),
+			jen.Id("DependencyStatus").Index(jen.Lit(t.name)).Op("=").Nil(),
+		),
+	}
+}
+
+// emitDependencyStatus writes DependencyStatus, if any dependency InitLaunchConfig creates is optional
+func emitDependencyStatus(f *jen.File, tasks []initTask) {
+	for _, t := range tasks {
+		if t.optional {
+			f.Comment("DependencyStatus records, for each optional dependency, the error that left its client nil, or nil if it was created")
+			f.Var().Id("DependencyStatus").Op("=").Map(jen.String()).Error().Values()
+			return
+		}
+	}
+}
+
+// emitInitLaunchConfig writes NewLaunchConfig, which runs preamble, then tasks, and returns config,
+// and the InitLaunchConfig shim
+func emitInitLaunchConfig(f *jen.File, opts options, preamble []jen.Code, tasks []initTask, config jen.Code) {
+	if opts.context {
+		emitInitLaunchConfigContext(f, opts, preamble, tasks, config)
+		return
+	}
+	lines := append(preamble, buildInitLines(tasks, opts)...)
+	lines = append(lines, jen.Return(config))
+
+	f.Comment("NewLaunchConfig creates a LaunchConfig, exiting the program if it can't")
+	f.Func().Id("NewLaunchConfig").Params(jen.Id("opts").Op("...").Id("Option")).Id("LaunchConfig").Block(lines...)
+
+	emitInitLaunchConfigShim(f)
+}
+
+// emitInitLaunchConfigShim writes InitLaunchConfig, which predates NewLaunchConfig
+func emitInitLaunchConfigShim(f *jen.File) {
+	f.Comment("InitLaunchConfig creates a LaunchConfig whose dependency clients trace to exp, if it is set.")
+	f.Comment("NewLaunchConfig takes more options.")
+	f.Func().Id("InitLaunchConfig").Params(jen.Id("exp").Op("*").Qual(sdkTracePath, "SpanExporter")).Id("LaunchConfig").Block(
+		jen.Return(jen.Id("NewLaunchConfig").Call(jen.Id("spanExporterOptions").Call(jen.Id("exp")).Op("..."))),
+	)
+}
+
+// envVarValue is the expression that reads an env var into the Environment struct
+func envVarValue(name string, opts options) jen.Code {
+	if !contains(optionalEnvVars, name) {
+		return jen.Id("requireEnvVar").Call(jen.Lit(name))
+	}
+	return optionalEnvVarValue(name, opts)
+}
+
+// optionalEnvVarValue is the expression that reads an env var, or "" if it isn't set
+func optionalEnvVarValue(name string, opts options) *jen.Statement {
+	if opts.flags {
+		return jen.Id("optionalEnvVar").Call(jen.Lit(name))
+	}
+	return jen.Id("os.Getenv").Call(jen.Lit(name))
+}
+
+// emitRequireEnvVar writes requireEnvVar, which falls back to defaults, and with -flags the flag-aware lookups
+func emitRequireEnvVar(f *jen.File, opts options, defaults map[string]string) {
+	if opts.flags {
+		emitFlagAwareEnvVarLookups(f, opts, defaults)
+		return
+	}
+	if len(defaults) == 0 {
+		f.Comment(`requireEnvVar exits the program immediately if an env var is not set`)
+		f.Func().Id("requireEnvVar").Params(jen.Id("s").String()).String().Block(
+			jen.List(jen.Id("val"), jen.Id("present")).Op(":=").Qual("os", "LookupEnv").Call(jen.Id("s")),
+			jen.If(jen.Op("!").Id("present")).Block(
+				missingEnvVarFatal(opts),
+			),
+			jen.Return(jen.Id("val")),
+		)
+		return
+	}
+	emitEnvVarDefaults(f, defaults)
+	f.Comment(`requireEnvVar exits the program immediately if an env var is not set in the environment or by default`)
 	f.Func().Id("requireEnvVar").Params(jen.Id("s").String()).String().Block(
 		jen.List(jen.Id("val"), jen.Id("present")).Op(":=").Qual("os", "LookupEnv").Call(jen.Id("s")),
 		jen.If(jen.Op("!").Id("present")).Block(
-			jen.Qual("log", "Fatalf").Call(jen.List(jen.Lit("env var %s is not defined"), jen.Id("s"))),
+			jen.List(jen.Id("val"), jen.Id("present")).Op("=").Id("envVarDefaults").Index(jen.Id("s")),
+		),
+		jen.If(jen.Op("!").Id("present")).Block(
+			missingEnvVarFatal(opts),
 		),
 		jen.Return(jen.Id("val")),
 	)
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dave/jennifer/jen"
+)
+
+const defaultInitTimeout = 30 * time.Second
+
+// durationExpr renders a duration the way a person would write it, e.g. 30 * time.Second
+func durationExpr(d time.Duration) jen.Code {
+	units := []struct {
+		unit time.Duration
+		name string
+	}{
+		{time.Hour, "Hour"},
+		{time.Minute, "Minute"},
+		{time.Second, "Second"},
+		{time.Millisecond, "Millisecond"},
+		{time.Microsecond, "Microsecond"},
+	}
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return jen.Lit(int(d/u.unit)).Op("*").Qual("time", u.name)
+		}
+	}
+	return jen.Lit(int(d)).Op("*").Qual("time", "Nanosecond")
+}
+
+// initErrorFatal is how NewLaunchConfig exits the program if NewLaunchConfigContext fails
+func initErrorFatal(opts options) jen.Code {
+	if opts.logFormat == "" {
+		return jen.Qual("log", "Fatal").Call(jen.Err())
+	}
+	return jen.Id("fatal").Call(jen.Lit("init-error"), jen.Err().Dot("Error").Call(), jen.Map(jen.String()).Interface().Values(jen.Dict{
+		jen.Lit("error"): jen.Err().Dot("Error").Call(),
+	}))
+}
+
+// initErrorReturn returns err from NewLaunchConfigContext, shutting down anything already created if
+// closers were set up
+func initErrorReturn(err jen.Code, withClosers bool) []jen.Code {
+	lines := []jen.Code{}
+	if withClosers {
+		lines = append(lines, jen.Id("o").Dot("closers").Dot("close").Call(jen.Qual("context", "Background").Call()))
+	}
+	return append(lines, jen.Return(jen.Id("LaunchConfig").Values(), err))
+}
+
+// requiredEnvVars are the env vars without a default that requireEnvVar reads while NewLaunchConfigContext builds the config
+func requiredEnvVars(items []specItem) []string {
+	envVars := []string{}
+	for _, item := range items {
+		if item.kind == specKindEnvVar && item.required && item.defaultValue == "" {
+			envVars = append(envVars, item.envVar)
+		}
+	}
+	return envVars
+}
+
+// hasS3Buckets reports whether items read the deploy env to name S3 buckets
+func hasS3Buckets(items []specItem) bool {
+	for _, item := range items {
+		if item.kind == specKindS3Bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequiredEnvVarsLines return checkRequiredEnvVars' error from NewLaunchConfigContext, if it is emitted
+func checkRequiredEnvVarsLines(items []specItem, opts options) []jen.Code {
+	if !opts.context || (len(requiredEnvVars(items)) == 0 && !hasS3Buckets(items)) {
+		return []jen.Code{}
+	}
+	return []jen.Code{
+		jen.If(jen.Err().Op(":=").Id("checkRequiredEnvVars").Call(), jen.Err().Op("!=").Nil()).Block(
+			jen.Return(jen.Id("LaunchConfig").Values(), jen.Err()),
+		),
+	}
+}
+
+// emitCheckRequiredEnvVars writes checkRequiredEnvVars, which NewLaunchConfigContext calls so that a missing
+// env var is returned as an error, rather than exiting the program in requireEnvVar or getS3NameByEnv
+func emitCheckRequiredEnvVars(f *jen.File, items []specItem, opts options) {
+	envVars := requiredEnvVars(items)
+	buckets := hasS3Buckets(items)
+	if !opts.context || (len(envVars) == 0 && !buckets) {
+		return
+	}
+	lookup := jen.Qual("os", "LookupEnv")
+	if opts.flags {
+		lookup = jen.Id("lookupEnvVarOrDefault")
+	}
+
+	f.Comment("requiredEnvVars are the env vars checkRequiredEnvVars checks")
+	f.Var().Id("requiredEnvVars").Op("=").Index().String().ValuesFunc(func(g *jen.Group) {
+		for _, envVar := range envVars {
+			g.Line().Lit(envVar)
+		}
+		g.Line()
+	})
+
+	f.Comment("checkRequiredEnvVars returns an error listing every required env var that is missing")
+	f.Func().Id("checkRequiredEnvVars").Params().Error().BlockFunc(func(g *jen.Group) {
+		g.Id("missing").Op(":=").Index().String().Values()
+		g.For(jen.List(jen.Id("_"), jen.Id("envVar")).Op(":=").Range().Id("requiredEnvVars")).Block(
+			jen.If(jen.List(jen.Id("_"), jen.Id("ok")).Op(":=").Add(lookup).Call(jen.Id("envVar")), jen.Op("!").Id("ok")).Block(
+				jen.Id("missing").Op("=").Append(jen.Id("missing"), jen.Id("envVar")),
+			),
+		)
+		if buckets {
+			g.If(currentDeployEnv().Op("==").Lit("")).Block(
+				jen.Id("missing").Op("=").Append(jen.Id("missing"), jen.Lit("DEPLOY_ENV")),
+			)
+		}
+		g.If(jen.Len(jen.Id("missing")).Op(">").Lit(0)).Block(
+			jen.Return(jen.Qual("fmt", "Errorf").Call(jen.Lit("missing env vars: %s"), jen.Qual("strings", "Join").Call(jen.Id("missing"), jen.Lit(", ")))),
+		)
+		g.Return(jen.Nil())
+	})
+}
+
+// emitInitLaunchConfigContext writes NewLaunchConfigContext, which runs tasks concurrently under
+// InitTimeout and returns their errors in declaration order, a NewLaunchConfig that wraps it, and
+// the InitLaunchConfig shim. Optional tasks' errors are recorded in DependencyStatus instead.
+// The preamble returns, rather than exits on, missing env vars and .env.local errors.
+func emitInitLaunchConfigContext(f *jen.File, opts options, preamble []jen.Code, tasks []initTask, config jen.Code) {
+	f.Comment("InitTimeout bounds how long NewLaunchConfigContext waits for dependency clients and external URLs")
+	f.Var().Id("InitTimeout").Op("=").Add(durationExpr(opts.initTimeout))
+
+	f.Comment("NewLaunchConfig creates a LaunchConfig, exiting the program if it can't")
+	f.Func().Id("NewLaunchConfig").Params(jen.Id("opts").Op("...").Id("Option")).Id("LaunchConfig").Block(
+		jen.List(jen.Id("c"), jen.Err()).Op(":=").Id("NewLaunchConfigContext").Call(jen.Qual("context", "Background").Call(), jen.Id("opts").Op("...")),
+		jen.If(jen.Err().Op("!=").Nil()).Block(
+			initErrorFatal(opts),
+		),
+		jen.Return(jen.Id("c")),
+	)
+
+	withClosers := needsInitOptions(tasks)
+	lines := preamble
+	if len(tasks) > 0 {
+		lines = append(lines,
+			jen.List(jen.Id("ctx"), jen.Id("cancel")).Op(":=").Qual("context", "WithTimeout").Call(jen.Id("ctx"), jen.Id("InitTimeout")),
+			jen.Defer().Id("cancel").Call(),
+			jen.Var().DefsFunc(func(g *jen.Group) {
+				for _, t := range tasks {
+					g.Id(t.varName).Add(t.varType)
+				}
+			}),
+			jen.Id("errs").Op(":=").Make(jen.Index().Error(), jen.Lit(len(tasks))),
+			jen.Comment("finished records which tasks are done, so a timeout can name the ones still pending"),
+			jen.Var().Id("finishedMu").Qual("sync", "Mutex"),
+			jen.Id("finished").Op(":=").Make(jen.Index().Bool(), jen.Lit(len(tasks))),
+			jen.Var().Id("wg").Qual("sync", "WaitGroup"),
+			jen.Id("wg").Dot("Add").Call(jen.Lit(len(tasks))),
+		)
+		for i, t := range tasks {
+			lines = append(lines, jen.Go().Func().Params().Block(
+				jen.Defer().Id("wg").Dot("Done").Call(),
+				jen.List(jen.Id("c"), jen.Err()).Op(":=").Add(t.call),
+				jen.Id("finishedMu").Dot("Lock").Call(),
+				jen.Defer().Id("finishedMu").Dot("Unlock").Call(),
+				jen.Id("finished").Index(jen.Lit(i)).Op("=").True(),
+				jen.If(jen.Err().Op("!=").Nil()).Block(
+					jen.Id("errs").Index(jen.Lit(i)).Op("=").Qual("fmt", "Errorf").Call(jen.Lit(t.name+": %w"), jen.Err()),
+					jen.Return(),
+				),
+				jen.Id(t.varName).Op("=").Id("c"),
+			).Call())
+		}
+		lines = append(lines,
+			jen.Id("done").Op(":=").Make(jen.Chan().Struct()),
+			jen.Go().Func().Params().Block(
+				jen.Id("wg").Dot("Wait").Call(),
+				jen.Close(jen.Id("done")),
+			).Call(),
+			jen.Select().Block(
+				jen.Case(jen.Op("<-").Id("done")),
+				jen.Case(jen.Op("<-").Id("ctx").Dot("Done").Call()).Block(append([]jen.Code{
+					jen.Id("finishedMu").Dot("Lock").Call(),
+					jen.Id("pending").Op(":=").Index().String().Values(),
+					jen.For(jen.List(jen.Id("i"), jen.Id("name")).Op(":=").Range().Index().String().ValuesFunc(func(g *jen.Group) {
+						for _, t := range tasks {
+							g.Lit(t.name)
+						}
+					})).Block(
+						jen.If(jen.Op("!").Id("finished").Index(jen.Id("i"))).Block(
+							jen.Id("pending").Op("=").Append(jen.Id("pending"), jen.Id("name")),
+						),
+					),
+					jen.Id("finishedMu").Dot("Unlock").Call(),
+				}, initErrorReturn(jen.Qual("fmt", "Errorf").Call(jen.Lit("timed out creating %s: %w"), jen.Qual("strings", "Join").Call(jen.Id("pending"), jen.Lit(", ")), jen.Id("ctx").Dot("Err").Call()), withClosers)...)...),
+			),
+		)
+		for i, t := range tasks {
+			if !t.optional {
+				continue
+			}
+			lines = append(lines,
+				jen.Id("DependencyStatus").Index(jen.Lit(t.name)).Op("=").Id("errs").Index(jen.Lit(i)),
+				jen.If(jen.Id("errs").Index(jen.Lit(i)).Op("!=").Nil()).Block(
+					jen.Id("o").Dot("logger").Dot("Printf").Call(jen.Lit("warning: optional dependency "+t.name+" is unavailable: %s"), jen.Id("errs").Index(jen.Lit(i))),
+					jen.Id("errs").Index(jen.Lit(i)).Op("=").Nil(),
+				),
+			)
+		}
+		lines = append(lines,
+			jen.If(jen.Err().Op(":=").Qual("errors", "Join").Call(jen.Id("errs").Op("...")), jen.Err().Op("!=").Nil()).Block(
+				initErrorReturn(jen.Err(), withClosers)...,
+			),
+		)
+	}
+	lines = append(lines, jen.Return(config, jen.Nil()))
+
+	f.Comment("NewLaunchConfigContext creates a LaunchConfig. Dependency clients and external URLs are created")
+	f.Comment("concurrently, and any errors are returned in declaration order. If it fails, it shuts down whatever")
+	f.Comment("it had already created. Failures aren't retried: discovery only reads env vars, and clients connect")
+	f.Comment("lazily, so creating them has no transient failures.")
+	f.Func().Id("NewLaunchConfigContext").Params(
+		jen.Id("ctx").Qual("context", "Context"),
+		jen.Id("opts").Op("...").Id("Option"),
+	).Params(jen.Id("LaunchConfig"), jen.Error()).Block(lines...)
+
+	emitInitLaunchConfigShim(f)
+}
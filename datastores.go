@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// datastore is a datastores entry: a database or cache configured through env vars that share a prefix
+type datastore struct {
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+	// Prefix is the env vars' prefix, e.g. MAIN_DB for MAIN_DB_HOST. It defaults to the name.
+	Prefix    string `yaml:"prefix"`
+	entryDocs `yaml:",inline"`
+}
+
+// prefix is the datastore's env var prefix
+func (d datastore) prefix() string {
+	if d.Prefix != "" {
+		return d.Prefix
+	}
+	return toEnvVarName(d.Name)
+}
+
+// datastoreField is a field of a datastore's config, read from <prefix>_<suffix>
+type datastoreField struct {
+	field    string
+	suffix   string
+	required bool
+}
+
+// datastoreKind is a kind of datastore, and the config type generated for it
+type datastoreKind struct {
+	typeName    string
+	description string
+	defaultPort string
+	fields      []datastoreField
+	// urlLines build u, a *url.URL, from c and port
+	urlLines func() []jen.Code
+}
+
+// userInfoLines set u's user info from c's User and Password. A password without a user is passed
+// through, as drivers such as Redis's accept it.
+func userInfoLines() []jen.Code {
+	return []jen.Code{
+		jen.If(jen.Id("c").Dot("Password").Op("!=").Lit("")).Block(
+			jen.Id("u").Dot("User").Op("=").Qual("net/url", "UserPassword").Call(jen.Id("c").Dot("User"), jen.Id("c").Dot("Password")),
+		).Else().If(jen.Id("c").Dot("User").Op("!=").Lit("")).Block(
+			jen.Id("u").Dot("User").Op("=").Qual("net/url", "User").Call(jen.Id("c").Dot("User")),
+		),
+	}
+}
+
+var datastoreKinds = map[string]datastoreKind{
+	"postgres": {
+		typeName:    "PostgresConfig",
+		description: "Postgres database",
+		defaultPort: "5432",
+		fields: []datastoreField{
+			{field: "Host", suffix: "HOST", required: true},
+			{field: "Port", suffix: "PORT"},
+			{field: "User", suffix: "USER", required: true},
+			{field: "Password", suffix: "PASSWORD"},
+			{field: "Database", suffix: "DATABASE", required: true},
+			{field: "TLS", suffix: "TLS"},
+		},
+		urlLines: func() []jen.Code {
+			return append([]jen.Code{
+				jen.Id("u").Op(":=").Op("&").Qual("net/url", "URL").Values(jen.Dict{
+					jen.Id("Scheme"): jen.Lit("postgres"),
+					jen.Id("Host"):   jen.Qual("net", "JoinHostPort").Call(jen.Id("c").Dot("Host"), jen.Id("port")),
+					jen.Id("Path"):   jen.Lit("/").Op("+").Id("c").Dot("Database"),
+				}),
+			}, append(userInfoLines(),
+				jen.Id("sslmode").Op(":=").Lit("disable"),
+				jen.If(jen.Id("c").Dot("TLS")).Block(
+					jen.Id("sslmode").Op("=").Lit("require"),
+				),
+				jen.Id("u").Dot("RawQuery").Op("=").Qual("net/url", "Values").Values(jen.Dict{
+					jen.Lit("sslmode"): jen.Values(jen.Id("sslmode")),
+				}).Dot("Encode").Call(),
+			)...)
+		},
+	},
+	"redis": {
+		typeName:    "RedisConfig",
+		description: "Redis cache",
+		defaultPort: "6379",
+		fields: []datastoreField{
+			{field: "Host", suffix: "HOST", required: true},
+			{field: "Port", suffix: "PORT"},
+			{field: "User", suffix: "USER"},
+			{field: "Password", suffix: "PASSWORD"},
+			{field: "Database", suffix: "DATABASE"},
+			{field: "TLS", suffix: "TLS"},
+		},
+		urlLines: func() []jen.Code {
+			return append([]jen.Code{
+				jen.Id("u").Op(":=").Op("&").Qual("net/url", "URL").Values(jen.Dict{
+					jen.Id("Scheme"): jen.Lit("redis"),
+					jen.Id("Host"):   jen.Qual("net", "JoinHostPort").Call(jen.Id("c").Dot("Host"), jen.Id("port")),
+				}),
+				jen.If(jen.Id("c").Dot("TLS")).Block(
+					jen.Id("u").Dot("Scheme").Op("=").Lit("rediss"),
+				),
+			}, append(userInfoLines(),
+				jen.If(jen.Id("c").Dot("Database").Op("!=").Lit("")).Block(
+					jen.Id("u").Dot("Path").Op("=").Lit("/").Op("+").Id("c").Dot("Database"),
+				),
+			)...)
+		},
+	},
+	"mongodb": {
+		typeName:    "MongoDBConfig",
+		description: "MongoDB database",
+		defaultPort: "27017",
+		fields: []datastoreField{
+			{field: "Host", suffix: "HOST", required: true},
+			{field: "Port", suffix: "PORT"},
+			{field: "User", suffix: "USER"},
+			{field: "Password", suffix: "PASSWORD"},
+			{field: "Database", suffix: "DATABASE", required: true},
+			{field: "TLS", suffix: "TLS"},
+		},
+		urlLines: func() []jen.Code {
+			return append([]jen.Code{
+				jen.Id("u").Op(":=").Op("&").Qual("net/url", "URL").Values(jen.Dict{
+					jen.Id("Scheme"): jen.Lit("mongodb"),
+					jen.Id("Host"):   jen.Qual("net", "JoinHostPort").Call(jen.Id("c").Dot("Host"), jen.Id("port")),
+					jen.Id("Path"):   jen.Lit("/").Op("+").Id("c").Dot("Database"),
+				}),
+			}, append(userInfoLines(),
+				jen.If(jen.Id("c").Dot("TLS")).Block(
+					jen.Id("u").Dot("RawQuery").Op("=").Lit("tls=true"),
+				),
+			)...)
+		},
+	},
+}
+
+// sortedDatastoreKinds are the datastoreKinds' names, for error messages
+func sortedDatastoreKinds() []string {
+	kinds := []string{}
+	for k := range datastoreKinds {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// validateDatastores checks that every datastore has a unique name and prefix, and a known kind
+func validateDatastores(datastores []datastore) error {
+	names := map[string]bool{}
+	prefixes := map[string]string{}
+	for _, d := range datastores {
+		if d.Name == "" {
+			return fmt.Errorf("datastore has no name")
+		}
+		if _, ok := datastoreKinds[d.Kind]; !ok {
+			return fmt.Errorf("datastore %q has unknown kind %q, must be one of %v", d.Name, d.Kind, sortedDatastoreKinds())
+		}
+		if names[toPublicVar(d.Name)] {
+			return fmt.Errorf("datastore %q is declared more than once", d.Name)
+		}
+		names[toPublicVar(d.Name)] = true
+		if other, ok := prefixes[d.prefix()]; ok {
+			return fmt.Errorf("datastores %q and %q both use the env var prefix %s", other, d.Name, d.prefix())
+		}
+		prefixes[d.prefix()] = d.Name
+	}
+	return nil
+}
+
+// datastoreSpecs describe each datastore's env vars
+func datastoreSpecs(datastores []datastore) []specItem {
+	items := []specItem{}
+	for _, d := range datastores {
+		kind := datastoreKinds[d.Kind]
+		for _, df := range kind.fields {
+			item := envVarSpec(d.prefix()+"_"+df.suffix, df.required, false)
+			item.description = kind.description + " " + d.Name
+			item.deprecated = d.Deprecated
+			item.value = jen.Id("c").Dot("Datastores").Dot(toPublicVar(d.Name)).Dot(df.field)
+			if df.field == "TLS" {
+				item.value = jen.Qual("strconv", "FormatBool").Call(item.value)
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// datastoreEnvVars are the env vars the datastores are configured by, in order
+func datastoreEnvVars(datastores []datastore) []string {
+	envVars := []string{}
+	for _, d := range datastores {
+		for _, df := range datastoreKinds[d.Kind].fields {
+			envVars = append(envVars, d.prefix()+"_"+df.suffix)
+		}
+	}
+	return envVars
+}
+
+// emitDatastores writes Datastores and the config types it uses, and returns the dict that populates it
+func emitDatastores(f *jen.File, datastores []datastore, opts options) jen.Dict {
+	f.Comment("Datastores has the connection config of the service's databases and caches")
+	f.Type().Id("Datastores").StructFunc(func(g *jen.Group) {
+		for _, d := range datastores {
+			for _, c := range d.comments() {
+				g.Add(c)
+			}
+			g.Id(toPublicVar(d.Name)).Id(datastoreKinds[d.Kind].typeName)
+		}
+	})
+
+	used := map[string]bool{}
+	dict := jen.Dict{}
+	for _, d := range datastores {
+		kind := datastoreKinds[d.Kind]
+		used[d.Kind] = true
+		values := jen.Dict{}
+		for _, df := range kind.fields {
+			envVar := d.prefix() + "_" + df.suffix
+			switch {
+			case df.field == "TLS":
+				values[jen.Id(df.field)] = optionalEnvVarValue(envVar, opts).Op("==").Lit("true")
+			case df.required:
+				values[jen.Id(df.field)] = jen.Id("requireEnvVar").Call(jen.Lit(envVar))
+			default:
+				values[jen.Id(df.field)] = optionalEnvVarValue(envVar, opts)
+			}
+		}
+		dict[jen.Id(toPublicVar(d.Name))] = jen.Id(kind.typeName).Values(values)
+	}
+
+	for _, name := range sortedDatastoreKinds() {
+		if used[name] {
+			emitDatastoreKind(f, datastoreKinds[name])
+		}
+	}
+	return dict
+}
+
+// emitDatastoreKind writes a datastore kind's config type, its URL, and String, which redacts the password
+func emitDatastoreKind(f *jen.File, kind datastoreKind) {
+	f.Comment(kind.typeName + " connects to a " + kind.description + ". TLS is set by \"true\".")
+	f.Type().Id(kind.typeName).StructFunc(func(g *jen.Group) {
+		for _, df := range kind.fields {
+			if df.field == "TLS" {
+				g.Id(df.field).Bool()
+				continue
+			}
+			g.Id(df.field).String()
+		}
+	})
+
+	f.Comment("connURL builds c's connection URL, escaping each part")
+	f.Func().Params(jen.Id("c").Id(kind.typeName)).Id("connURL").Params().Op("*").Qual("net/url", "URL").BlockFunc(func(g *jen.Group) {
+		g.Id("port").Op(":=").Id("c").Dot("Port")
+		g.If(jen.Id("port").Op("==").Lit("")).Block(
+			jen.Id("port").Op("=").Lit(kind.defaultPort),
+		)
+		for _, line := range kind.urlLines() {
+			g.Add(line)
+		}
+		g.Return(jen.Id("u"))
+	})
+
+	f.Comment("URL is c's connection URL, including its password. It can be passed to drivers as a DSN.")
+	f.Func().Params(jen.Id("c").Id(kind.typeName)).Id("URL").Params().String().Block(
+		jen.Return(jen.Id("c").Dot("connURL").Call().Dot("String").Call()),
+	)
+
+	f.Comment("String is c's connection URL, with its password redacted")
+	f.Func().Params(jen.Id("c").Id(kind.typeName)).Id("String").Params().String().Block(
+		jen.Return(jen.Id("c").Dot("connURL").Call().Dot("Redacted").Call()),
+	)
+
+	f.Comment("GoString redacts c's password from %#v, too")
+	f.Func().Params(jen.Id("c").Id(kind.typeName)).Id("GoString").Params().String().Block(
+		jen.Return(jen.Id("c").Dot("String").Call()),
+	)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"github.com/dave/jennifer/jen"
+)
+
+// deployEnvs are the generated DeployEnv constants
+var deployEnvs = []struct {
+	name    string
+	value   string
+	comment string
+}{
+	{name: "DeployEnvProduction", value: "production", comment: "DeployEnvProduction is production"},
+	{name: "DeployEnvDev", value: "clever-dev", comment: "DeployEnvDev is the shared development environment"},
+	{name: "DeployEnvLocal", value: "local", comment: "DeployEnvLocal is a developer's machine"},
+}
+
+// currentDeployEnv is the generated code's deploy environment
+func currentDeployEnv() *jen.Statement {
+	return jen.Id("CurrentDeployEnv").Call()
+}
+
+// emitDeployEnv writes DeployEnv, its constants and helpers, and CurrentDeployEnv
+func emitDeployEnv(f *jen.File) {
+	f.Comment("DeployEnv is a deployment environment")
+	f.Type().Id("DeployEnv").String()
+
+	f.Const().DefsFunc(func(g *jen.Group) {
+		for _, e := range deployEnvs {
+			g.Comment(e.comment)
+			g.Id(e.name).Id("DeployEnv").Op("=").Lit(e.value)
+		}
+	})
+
+	f.Comment(`CurrentDeployEnv returns DEPLOY_ENV, or else _DEPLOY_ENV, or "" if neither is set. They're injected by our`)
+	f.Comment(`deployment system for Lambda and non-Lambda deployments, respectively.`)
+	f.Func().Id("CurrentDeployEnv").Params().Id("DeployEnv").Block(
+		jen.If(jen.Id("env").Op(":=").Qual("os", "Getenv").Call(jen.Lit("DEPLOY_ENV")), jen.Id("env").Op("!=").Lit("")).Block(
+			jen.Return(jen.Id("DeployEnv").Call(jen.Id("env"))),
+		),
+		jen.Return(jen.Id("DeployEnv").Call(jen.Qual("os", "Getenv").Call(jen.Lit("_DEPLOY_ENV")))),
+	)
+
+	f.Comment("IsProduction reports whether e is production")
+	f.Func().Params(jen.Id("e").Id("DeployEnv")).Id("IsProduction").Params().Bool().Block(
+		jen.Return(jen.Id("e").Op("==").Id("DeployEnvProduction")),
+	)
+
+	f.Comment(`IsDev reports whether e is set, and isn't production. Like S3 bucket names, it treats every other`)
+	f.Comment(`environment, including local, as dev.`)
+	f.Func().Params(jen.Id("e").Id("DeployEnv")).Id("IsDev").Params().Bool().Block(
+		jen.Return(jen.Id("e").Op("!=").Lit("").Op("&&").Op("!").Id("e").Dot("IsProduction").Call()),
+	)
+
+	f.Comment("IsLocal reports whether e is local")
+	f.Func().Params(jen.Id("e").Id("DeployEnv")).Id("IsLocal").Params().Bool().Block(
+		jen.Return(jen.Id("e").Op("==").Id("DeployEnvLocal")),
+	)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// discoveryEnvVarSets lists, per expose, the env vars discovery-go reads for a dependency
+func discoveryEnvVarSets(dep string, exposes []string) [][]string {
+	sets := [][]string{}
+	for _, expose := range exposes {
+		prefix := "SERVICE_" + toEnvVarName(dep) + "_" + toEnvVarName(expose) + "_"
+		sets = append(sets, []string{prefix + "PROTO", prefix + "HOST", prefix + "PORT"})
+	}
+	return sets
+}
+
+// discoveryRequirement is what a dependency or external URL needs to be discovered at startup
+func discoveryRequirement(item specItem) requirement {
+	req := requirement{kind: item.kind, name: item.name, required: item.required}
+	if item.kind == specKindDependency {
+		req.envVarSets = discoveryEnvVarSets(item.name, item.exposes)
+	} else {
+		req.envVarSets = [][]string{{item.envVar}}
+	}
+	return req
+}
+
+func discoveryRequirements(items []specItem) []requirement {
+	reqs := []requirement{}
+	for _, item := range items {
+		if item.kind == specKindDependency || item.kind == specKindExternalURL {
+			reqs = append(reqs, discoveryRequirement(item))
+		}
+	}
+	return reqs
+}
+
+// startupDiscoveryRequirements are checked by InitLaunchConfig. Lazy dependencies are left to their
+// accessors, and optional dependencies degrade rather than exit the program.
+func startupDiscoveryRequirements(items []specItem, opts options) []requirement {
+	reqs := []requirement{}
+	for _, req := range discoveryRequirements(items) {
+		if req.kind == specKindDependency && (opts.lazy || !req.required) {
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+// missingDiscoveryMessage lists every dependency and external URL that can't be discovered, in the
+// same format as the generated requireDiscoveryEnvVars
+func missingDiscoveryMessage(results []preflightResult) string {
+	missing := []string{}
+	for _, r := range results {
+		if r.ok() || !r.required || (r.kind != specKindDependency && r.kind != specKindExternalURL) {
+			continue
+		}
+		missing = append(missing, r.name+" ("+strings.Join(r.missing, ", ")+")")
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return "missing discovery env vars: " + strings.Join(missing, "; ")
+}
+
+// requireDiscoveryLines call requireDiscoveryEnvVars, if it is emitted. With -context, they return the
+// missing env vars from NewLaunchConfigContext as an error instead.
+func requireDiscoveryLines(reqs []requirement, opts options) []jen.Code {
+	if len(reqs) == 0 {
+		return []jen.Code{}
+	}
+	if opts.context {
+		return []jen.Code{
+			jen.If(jen.Id("missing").Op(":=").Id("missingDiscoveryEnvVars").Call(), jen.Len(jen.Id("missing")).Op(">").Lit(0)).Block(
+				jen.Return(jen.Id("LaunchConfig").Values(), jen.Qual("fmt", "Errorf").Call(jen.Lit("missing discovery env vars: %s"), jen.Qual("strings", "Join").Call(jen.Id("missing"), jen.Lit("; ")))),
+			),
+		}
+	}
+	return []jen.Code{jen.Id("requireDiscoveryEnvVars").Call()}
+}
+
+// emitRequireDiscoveryEnvVars writes requireDiscoveryEnvVars, which checks every discovery env var up
+// front so a misconfigured environment reports all of them at once
+func emitRequireDiscoveryEnvVars(f *jen.File, reqs []requirement, opts options) {
+	if len(reqs) == 0 {
+		return
+	}
+
+	f.Comment("discoveryRequirement lists the env vars discovery reads for a dependency or external URL.")
+	f.Comment("It is met once every env var in any one of envVarSets is present.")
+	f.Type().Id("discoveryRequirement").Struct(
+		jen.Id("name").String(),
+		jen.Id("envVarSets").Index().Index().String(),
+	)
+
+	f.Comment("discoveryRequirements are checked by missingDiscoveryEnvVars before any client is created")
+	f.Var().Id("discoveryRequirements").Op("=").Index().Id("discoveryRequirement").ValuesFunc(func(g *jen.Group) {
+		for _, req := range reqs {
+			g.Line().Values(jen.Dict{
+				jen.Id("name"): jen.Lit(req.name),
+				jen.Id("envVarSets"): jen.Index().Index().String().ValuesFunc(func(sets *jen.Group) {
+					for _, set := range req.envVarSets {
+						sets.ValuesFunc(func(envVars *jen.Group) {
+							for _, envVar := range set {
+								envVars.Lit(envVar)
+							}
+						})
+					}
+				}),
+			})
+		}
+		g.Line()
+	})
+
+	f.Comment("missingDiscoveryEnvVars lists each dependency or external URL that can't be discovered, with its missing env vars")
+	f.Func().Id("missingDiscoveryEnvVars").Params().Index().String().Block(
+		jen.Id("missing").Op(":=").Index().String().Values(),
+		jen.For(jen.List(jen.Id("_"), jen.Id("r")).Op(":=").Range().Id("discoveryRequirements")).Block(
+			jen.Var().Id("absent").Index().String(),
+			jen.For(jen.List(jen.Id("i"), jen.Id("set")).Op(":=").Range().Id("r").Dot("envVarSets")).Block(
+				jen.Id("setAbsent").Op(":=").Index().String().Values(),
+				jen.For(jen.List(jen.Id("_"), jen.Id("envVar")).Op(":=").Range().Id("set")).Block(
+					jen.If(jen.List(jen.Id("_"), jen.Id("ok")).Op(":=").Add(lookupEnvVarFunc(opts)).Call(jen.Id("envVar")), jen.Op("!").Id("ok")).Block(
+						jen.Id("setAbsent").Op("=").Append(jen.Id("setAbsent"), jen.Id("envVar")),
+					),
+				),
+				jen.If(jen.Len(jen.Id("setAbsent")).Op("==").Lit(0)).Block(
+					jen.Id("absent").Op("=").Nil(),
+					jen.Break(),
+				),
+				jen.If(jen.Id("i").Op("==").Lit(0)).Block(
+					jen.Id("absent").Op("=").Id("setAbsent"),
+				),
+			),
+			jen.If(jen.Len(jen.Id("absent")).Op(">").Lit(0)).Block(
+				jen.Id("missing").Op("=").Append(jen.Id("missing"), jen.Id("r").Dot("name").Op("+").Lit(" (").Op("+").Qual("strings", "Join").Call(jen.Id("absent"), jen.Lit(", ")).Op("+").Lit(")")),
+			),
+		),
+		jen.Return(jen.Id("missing")),
+	)
+
+	if opts.context {
+		return
+	}
+	f.Comment("requireDiscoveryEnvVars exits the program, listing every missing env var, if any dependency or external URL can't be discovered")
+	f.Func().Id("requireDiscoveryEnvVars").Params().Block(
+		jen.Id("missing").Op(":=").Id("missingDiscoveryEnvVars").Call(),
+		jen.If(jen.Len(jen.Id("missing")).Op(">").Lit(0)).Block(
+			fatalCall(opts, "missing-discovery-env-vars", jen.Dict{
+				jen.Lit("missing"): jen.Qual("strings", "Join").Call(jen.Id("missing"), jen.Lit("; ")),
+			}, "missing discovery env vars: %s", jen.Qual("strings", "Join").Call(jen.Id("missing"), jen.Lit("; "))),
+		),
+	)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// entryDocs document a YAML entry. Any entry can have them.
+type entryDocs struct {
+	Description string `yaml:"description"`
+	// Deprecated is why the entry is deprecated, and what to use instead
+	Deprecated string `yaml:"deprecated"`
+}
+
+// comments are d as the doc comment of a generated field or declaration, after any lines it already has.
+// The description and Deprecated are each their own paragraph, so that staticcheck flags uses.
+func (d entryDocs) comments(lines ...string) []jen.Code {
+	paragraph := func(s string) {
+		if len(lines) > 0 {
+			lines = append(lines, "//")
+		}
+		lines = append(lines, s)
+	}
+	if d.Description != "" {
+		paragraph(d.Description)
+	}
+	if d.Deprecated != "" {
+		paragraph("Deprecated: " + d.Deprecated)
+	}
+	codes := []jen.Code{}
+	for _, l := range lines {
+		codes = append(codes, jen.Comment(l))
+	}
+	return codes
+}
+
+// namedEntry is a YAML list entry that is either a bare name, or a mapping with a name and its docs
+type namedEntry struct {
+	Name      string `yaml:"name"`
+	entryDocs `yaml:",inline"`
+}
+
+func (e *namedEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		e.Name = name
+		return nil
+	}
+	type plain namedEntry
+	if err := unmarshal((*plain)(e)); err != nil {
+		return err
+	}
+	if e.Name == "" {
+		return fmt.Errorf("entry is missing a name")
+	}
+	return nil
+}
+
+// entryNames are the entries' names, in order
+func entryNames(entries []namedEntry) []string {
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// deprecatedEnvVar is an env var the generated code warns about, if it is set
+type deprecatedEnvVar struct {
+	envVar string
+	reason string
+}
+
+// deprecatedEnvVars are the env vars of the deprecated env vars, external URLs and datastores in items,
+// in spec order. Deprecated dependencies, S3 buckets, runtime keys and env groups aren't read from an env
+// var the service's config sets, so there is nothing to warn about at startup; their doc comments flag uses.
+func deprecatedEnvVars(items []specItem) []deprecatedEnvVar {
+	vars := []deprecatedEnvVar{}
+	for _, item := range items {
+		if item.deprecated == "" || item.injected || (item.kind != specKindEnvVar && item.kind != specKindExternalURL) {
+			continue
+		}
+		vars = append(vars, deprecatedEnvVar{envVar: item.envVar, reason: item.deprecated})
+	}
+	return vars
+}
+
+// warnDeprecatedEnvVarsLines call warnDeprecatedEnvVars, if it is emitted
+func warnDeprecatedEnvVarsLines(vars []deprecatedEnvVar) []jen.Code {
+	if len(vars) == 0 {
+		return []jen.Code{}
+	}
+	return []jen.Code{jen.Id("warnDeprecatedEnvVars").Call(jen.Id("opts"))}
+}
+
+// emitWarnDeprecatedEnvVars writes warnDeprecatedEnvVars, which logs each deprecated env var that is set,
+// once per process
+func emitWarnDeprecatedEnvVars(f *jen.File, vars []deprecatedEnvVar, opts options) {
+	if len(vars) == 0 {
+		return
+	}
+	f.Comment("deprecatedEnvVars are the deprecated env vars, and why, in the order they're declared")
+	f.Var().Id("deprecatedEnvVars").Op("=").Index().Struct(jen.List(jen.Id("envVar"), jen.Id("reason")).String()).ValuesFunc(func(g *jen.Group) {
+		for _, v := range vars {
+			g.Line().Values(jen.Lit(v.envVar), jen.Lit(v.reason))
+		}
+		g.Line()
+	})
+
+	f.Comment("warnDeprecatedEnvVarsOnce keeps warnDeprecatedEnvVars to one warning per env var per process")
+	f.Var().Id("warnDeprecatedEnvVarsOnce").Qual("sync", "Once")
+
+	f.Comment("warnDeprecatedEnvVars logs a warning for each deprecated env var that is set, to the WithLogger logger")
+	f.Func().Id("warnDeprecatedEnvVars").Params(jen.Id("opts").Index().Id("Option")).Block(
+		jen.Id("warnDeprecatedEnvVarsOnce").Dot("Do").Call(jen.Func().Params().Block(
+			jen.Id("o").Op(":=").Id("initOptions").Values(),
+			jen.For(jen.List(jen.Id("_"), jen.Id("opt")).Op(":=").Range().Id("opts")).Block(
+				jen.Id("opt").Call(jen.Op("&").Id("o")),
+			),
+			jen.Id("logger").Op(":=").Id("o").Dot("logger"),
+			jen.If(jen.Id("logger").Op("==").Nil()).Block(
+				jen.Id("logger").Op("=").Qual("log", "Default").Call(),
+			),
+			jen.For(jen.List(jen.Id("_"), jen.Id("v")).Op(":=").Range().Id("deprecatedEnvVars")).Block(
+				jen.If(jen.List(jen.Id("_"), jen.Id("ok")).Op(":=").Add(lookupEnvVarFunc(opts)).Call(jen.Id("v").Dot("envVar")), jen.Id("ok")).Block(
+					jen.Id("logger").Dot("Printf").Call(jen.Lit("warning: env var %s is deprecated: %s"), jen.Id("v").Dot("envVar"), jen.Id("v").Dot("reason")),
+				),
+			),
+		)),
+	)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+const localEnvFile = ".env.local"
+
+// envExampleValue quotes a value if parseEnvFile would otherwise misread it
+func envExampleValue(s string) string {
+	if strings.ContainsAny(s, " \t#'\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// writeEnvExample writes a .env.example listing every env var the YAML declares, with its description
+// and default. Optional env vars are commented out.
+func writeEnvExample(w io.Writer, source string, items []specItem) error {
+	lines := []string{
+		"# Generated by launch-gen from " + source + ". DO NOT EDIT.",
+		"# Copy to " + localEnvFile + " and fill in the blanks. It is loaded when DEPLOY_ENV=local.",
+	}
+	hasBuckets := false
+	for _, item := range items {
+		switch item.kind {
+		case specKindS3Bucket:
+			hasBuckets = true
+			continue
+		case specKindDependency:
+			comment := "# " + item.name + ": " + item.description + ", found through discovery"
+			prefix := ""
+			if !item.required {
+				comment += " (optional)"
+				prefix = "# "
+			}
+			set := discoveryEnvVarSets(item.name, item.exposes)[0]
+			lines = append(lines, "", comment, prefix+set[0]+"=http", prefix+set[1]+"=localhost", prefix+set[2]+"=")
+			continue
+		}
+
+		lines = append(lines, "")
+		comment := item.envVar
+		if item.description != "" {
+			comment += ": " + item.description
+		}
+		if !item.required {
+			comment += " (optional)"
+		}
+		if item.deprecated != "" {
+			comment += " (deprecated: " + item.deprecated + ")"
+		}
+		lines = append(lines, "# "+comment)
+		assignment := item.envVar + "=" + envExampleValue(item.defaultValue)
+		if !item.required {
+			assignment = "# " + assignment
+		}
+		lines = append(lines, assignment)
+	}
+	if hasBuckets {
+		lines = append(lines, "", "# DEPLOY_ENV picks S3 bucket names, and must be set in the process environment to load "+localEnvFile)
+		lines = append(lines, "# DEPLOY_ENV=local")
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// loadLocalEnvFileLines call loadLocalEnvFile, if it is emitted. With -context, they return its error from
+// NewLaunchConfigContext.
+func loadLocalEnvFileLines(opts options) []jen.Code {
+	if !opts.dotenv {
+		return []jen.Code{}
+	}
+	if opts.context {
+		return []jen.Code{
+			jen.If(jen.Err().Op(":=").Id("loadLocalEnvFile").Call(), jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Id("LaunchConfig").Values(), jen.Err()),
+			),
+		}
+	}
+	return []jen.Code{jen.Id("loadLocalEnvFile").Call()}
+}
+
+// emitLoadLocalEnvFile writes loadLocalEnvFile, which InitLaunchConfig calls first. With -context, it
+// returns its errors rather than exiting the program.
+func emitLoadLocalEnvFile(f *jen.File, opts options) {
+	// fail exits the program, or with -context returns an error
+	fail := func(title string, fields jen.Dict, format string, args ...jen.Code) jen.Code {
+		if opts.context {
+			return jen.Return(jen.Qual("fmt", "Errorf").Call(append([]jen.Code{jen.Lit(format)}, args...)...))
+		}
+		return fatalCall(opts, title, fields, format, args...)
+	}
+	// done returns from loadLocalEnvFile
+	done := func() jen.Code {
+		if opts.context {
+			return jen.Return(jen.Nil())
+		}
+		return jen.Return()
+	}
+	results := jen.Null()
+	if opts.context {
+		results = jen.Error()
+	}
+
+	f.Comment("loadLocalEnvFile sets env vars from " + localEnvFile + " when DEPLOY_ENV is \"local\". Values resolve in this order:")
+	f.Comment("  1. the process environment")
+	f.Comment("  2. " + localEnvFile + " in the working directory, if it exists")
+	f.Comment("Env vars still unset after that are handled as usual.")
+	f.Func().Id("loadLocalEnvFile").Params().Add(results).BlockFunc(func(g *jen.Group) {
+		g.If(jen.Op("!").Add(currentDeployEnv()).Dot("IsLocal").Call()).Block(
+			done(),
+		)
+		g.List(jen.Id("data"), jen.Err()).Op(":=").Qual("os", "ReadFile").Call(jen.Lit(localEnvFile))
+		g.If(jen.Qual("errors", "Is").Call(jen.Err(), jen.Qual("io/fs", "ErrNotExist"))).Block(
+			done(),
+		).Else().If(jen.Err().Op("!=").Nil()).Block(
+			fail("env-file-error", jen.Dict{
+				jen.Lit("file"):  jen.Lit(localEnvFile),
+				jen.Lit("error"): jen.Err().Dot("Error").Call(),
+			}, "error reading "+localEnvFile+": %s", jen.Err()),
+		)
+		g.For(jen.List(jen.Id("i"), jen.Id("line")).Op(":=").Range().Qual("strings", "Split").Call(jen.String().Call(jen.Id("data")), jen.Lit("\n"))).Block(
+			jen.Id("line").Op("=").Qual("strings", "TrimSpace").Call(jen.Id("line")),
+			jen.If(jen.Id("line").Op("==").Lit("").Op("||").Qual("strings", "HasPrefix").Call(jen.Id("line"), jen.Lit("#"))).Block(
+				jen.Continue(),
+			),
+			jen.Id("line").Op("=").Qual("strings", "TrimSpace").Call(jen.Qual("strings", "TrimPrefix").Call(jen.Id("line"), jen.Lit("export "))),
+			jen.List(jen.Id("key"), jen.Id("value"), jen.Id("found")).Op(":=").Qual("strings", "Cut").Call(jen.Id("line"), jen.Lit("=")),
+			jen.Id("key").Op("=").Qual("strings", "TrimSpace").Call(jen.Id("key")),
+			jen.If(jen.Op("!").Id("found").Op("||").Id("key").Op("==").Lit("")).Block(
+				fail("env-file-error", jen.Dict{
+					jen.Lit("file"): jen.Lit(localEnvFile),
+					jen.Lit("line"): jen.Id("i").Op("+").Lit(1),
+				}, localEnvFile+" line %d: expected KEY=VALUE", jen.Id("i").Op("+").Lit(1)),
+			),
+			jen.Id("value").Op("=").Qual("strings", "TrimSpace").Call(jen.Id("value")),
+			jen.If(jen.Len(jen.Id("value")).Op(">=").Lit(2).Op("&&").Parens(jen.Id("value").Index(jen.Lit(0)).Op("==").LitRune('"').Op("||").Id("value").Index(jen.Lit(0)).Op("==").LitRune('\'')).Op("&&").Id("value").Index(jen.Len(jen.Id("value")).Op("-").Lit(1)).Op("==").Id("value").Index(jen.Lit(0))).Block(
+				jen.If(jen.List(jen.Id("unquoted"), jen.Err()).Op(":=").Qual("strconv", "Unquote").Call(jen.Id("value")), jen.Err().Op("==").Nil()).Block(
+					jen.Id("value").Op("=").Id("unquoted"),
+				).Else().Block(
+					jen.Id("value").Op("=").Id("value").Index(jen.Lit(1), jen.Len(jen.Id("value")).Op("-").Lit(1)),
+				),
+			),
+			jen.If(jen.List(jen.Id("_"), jen.Id("set")).Op(":=").Qual("os", "LookupEnv").Call(jen.Id("key")), jen.Op("!").Id("set")).Block(
+				jen.Qual("os", "Setenv").Call(jen.Id("key"), jen.Id("value")),
+			),
+		)
+		if opts.context {
+			g.Return(jen.Nil())
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// envGroup is the declared group an env var is in, by longest prefix, or "" if it isn't in one.
+// REDIS_HOST is in the REDIS group.
+func envGroup(name string, groups []string) string {
+	group := ""
+	for _, g := range groups {
+		if strings.HasPrefix(name, g+"_") && len(name) > len(g)+1 && len(g) > len(group) {
+			group = g
+		}
+	}
+	return group
+}
+
+// envField is an env var's field name in Environment, or in its group's struct, without the group's prefix
+func envField(name, group string) string {
+	if group == "" {
+		return toPublicVar(name)
+	}
+	return toPublicVar(strings.TrimPrefix(name, group+"_"))
+}
+
+// envGroupType names a group's struct: REDIS => RedisEnvironment
+func envGroupType(group string) string {
+	return toPublicVar(group) + "Environment"
+}
+
+// envFieldPath is the expression, relative to a LaunchConfig `c`, that holds an env var's value
+func envFieldPath(name string, groups []string) *jen.Statement {
+	path := jen.Id("c").Dot("Env")
+	group := envGroup(name, groups)
+	if group != "" {
+		path = path.Dot(toPublicVar(group))
+	}
+	return path.Dot(envField(name, group))
+}
+
+// validateEnvGroups checks that every group is used, and that no two env vars, or an env var and a
+// group, end up with the same field name
+func validateEnvGroups(names, groups []string) error {
+	declared := map[string]bool{}
+	for _, g := range groups {
+		if g == "" || strings.HasSuffix(g, "_") {
+			return fmt.Errorf("env group %q must be a prefix without a trailing _, e.g. REDIS", g)
+		}
+		if declared[g] {
+			return fmt.Errorf("env group %q is declared more than once", g)
+		}
+		declared[g] = true
+	}
+
+	// fields are the names taken in each struct, by the env var or group that took them
+	fields := map[string]map[string]string{"": {}}
+	for _, g := range groups {
+		fields[g] = map[string]string{}
+	}
+	take := func(group, field, by string) error {
+		if other, ok := fields[group][field]; ok && other != by {
+			return fmt.Errorf("env %s and %s would both be the field %s", other, by, field)
+		}
+		fields[group][field] = by
+		return nil
+	}
+	for _, name := range names {
+		group := envGroup(name, groups)
+		if group != "" {
+			if err := take("", toPublicVar(group), "group "+group); err != nil {
+				return err
+			}
+		}
+		if err := take(group, envField(name, group), "var "+name); err != nil {
+			return err
+		}
+	}
+	for _, g := range groups {
+		if len(fields[g]) == 0 {
+			return fmt.Errorf("env group %q has no env vars", g)
+		}
+	}
+	return nil
+}
+
+// emitEnvironment writes Environment, with a nested struct per env group, and returns the dict that
+// populates it
+func emitEnvironment(f *jen.File, vars []namedEntry, groupEntries []namedEntry, opts options) jen.Dict {
+	groups := entryNames(groupEntries)
+	envStruct := []jen.Code{}
+	envInitDict := jen.Dict{}
+	groupStructs := map[string][]jen.Code{}
+	groupDicts := map[string]jen.Dict{}
+	for _, v := range vars {
+		name := v.Name
+		group := envGroup(name, groups)
+		if group == "" {
+			envStruct = append(envStruct, v.comments()...)
+			envStruct = append(envStruct, jen.List(jen.Id(toPublicVar(name))).String())
+			envInitDict[jen.Id(toPublicVar(name))] = envVarValue(name, opts)
+			continue
+		}
+		if _, ok := groupDicts[group]; !ok {
+			for _, g := range groupEntries {
+				if g.Name == group {
+					envStruct = append(envStruct, g.comments()...)
+				}
+			}
+			envStruct = append(envStruct, jen.Id(toPublicVar(group)).Id(envGroupType(group)))
+			groupDicts[group] = jen.Dict{}
+		}
+		groupStructs[group] = append(groupStructs[group], v.comments()...)
+		groupStructs[group] = append(groupStructs[group], jen.List(jen.Id(envField(name, group))).String())
+		groupDicts[group][jen.Id(envField(name, group))] = envVarValue(name, opts)
+	}
+
+	f.Comment("Environment has environment variables and their values")
+	f.Type().Id("Environment").Struct(envStruct...)
+
+	for _, g := range groupEntries {
+		for _, c := range g.comments(envGroupType(g.Name) + " has the " + g.Name + "_ environment variables") {
+			f.Add(c)
+		}
+		f.Type().Id(envGroupType(g.Name)).Struct(groupStructs[g.Name]...)
+		envInitDict[jen.Id(toPublicVar(g.Name))] = jen.Id(envGroupType(g.Name)).Values(groupDicts[g.Name])
+	}
+	return envInitDict
+}
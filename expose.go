@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// exposedPort is a port the service listens on: a launch.yml expose entry, or a values.yaml ports entry
+type exposedPort struct {
+	Name string `yaml:"name"`
+	Port int    `yaml:"port"`
+	// ContainerPort is the values.yaml spelling of Port
+	ContainerPort int `yaml:"containerPort"`
+	entryDocs     `yaml:",inline"`
+}
+
+// number is the port's number, however it was declared
+func (p exposedPort) number() int {
+	if p.Port != 0 {
+		return p.Port
+	}
+	return p.ContainerPort
+}
+
+// validateExposedPorts checks that every port has a unique name, and a unique number in range
+func validateExposedPorts(ports []exposedPort) error {
+	names := map[string]bool{}
+	numbers := map[int]string{}
+	for _, p := range ports {
+		if p.Name == "" {
+			return fmt.Errorf("exposed port %d has no name", p.number())
+		}
+		if names[toPublicVar(p.Name)] {
+			return fmt.Errorf("exposed port %q is declared more than once", p.Name)
+		}
+		names[toPublicVar(p.Name)] = true
+		if p.Port != 0 && p.ContainerPort != 0 && p.Port != p.ContainerPort {
+			return fmt.Errorf("exposed port %q has both port %d and containerPort %d", p.Name, p.Port, p.ContainerPort)
+		}
+		n := p.number()
+		if n < 1 || n > 65535 {
+			return fmt.Errorf("exposed port %q is %d, must be between 1 and 65535", p.Name, n)
+		}
+		if other, ok := numbers[n]; ok {
+			return fmt.Errorf("exposed ports %q and %q are both %d", other, p.Name, n)
+		}
+		numbers[n] = p.Name
+	}
+	return nil
+}
+
+// emitExpose writes Expose and Port, and returns the dict that populates Expose
+func emitExpose(f *jen.File, ports []exposedPort) jen.Dict {
+	f.Comment("Expose has the ports the service listens on")
+	f.Type().Id("Expose").StructFunc(func(g *jen.Group) {
+		for _, p := range ports {
+			for _, c := range p.comments() {
+				g.Add(c)
+			}
+			g.Id(toPublicVar(p.Name)).Id("Port")
+		}
+	})
+
+	f.Comment("Port is a port the service listens on")
+	f.Type().Id("Port").Struct(
+		jen.Id("Name").String(),
+		jen.Id("Number").Int(),
+	)
+
+	f.Comment(`ListenAddr is the address to listen on for p, e.g. ":80"`)
+	f.Func().Params(jen.Id("p").Id("Port")).Id("ListenAddr").Params().String().Block(
+		jen.Return(jen.Lit(":").Op("+").Qual("strconv", "Itoa").Call(jen.Id("p").Dot("Number"))),
+	)
+
+	dict := jen.Dict{}
+	for _, p := range ports {
+		dict[jen.Id(toPublicVar(p.Name))] = jen.Id("Port").Values(jen.Dict{
+			jen.Id("Name"):   jen.Lit(p.Name),
+			jen.Id("Number"): jen.Lit(p.number()),
+		})
+	}
+	return dict
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"io"
 	"sort"
+	"strings"
 
 	. "github.com/dave/jennifer/jen"
 	"github.com/go-yaml/yaml"
@@ -10,13 +11,17 @@ import (
 
 // LaunchYML Schema
 type LaunchYML struct {
-	Env              []string `yaml:"env"`
-	Dependencies     []string `yaml:"dependencies"`
-	ExternalUrlUsage []string `yaml:"externalUrlUsage"`
+	Env              []namedEntry  `yaml:"env"`
+	Dependencies     []dependency  `yaml:"dependencies"`
+	ExternalUrlUsage []namedEntry  `yaml:"externalUrlUsage"`
+	App              appMetadata   `yaml:"app"`
+	Expose           []exposedPort `yaml:"expose"`
+	Datastores       []datastore   `yaml:"datastores"`
+	EnvGroups        []namedEntry  `yaml:"envGroups"`
 	Aws              struct {
 		S3 struct {
-			Read  []string `json:"read"`
-			Write []string `json:"write"`
+			Read  []namedEntry `json:"read"`
+			Write []namedEntry `json:"write"`
 		} `json:"s3"`
 	} `json:"aws"`
 }
@@ -36,61 +41,129 @@ func sortedKeys(m map[string]struct{}) []string {
 	return keys
 }
 
-func generateFargate(packageName string, skipDependencies map[string]bool, overrideDependenciesString string, data []byte, output io.Writer) error {
+// s3BucketSpec describes an S3 bucket, whose name is derived from the deploy environment
+func s3BucketSpec(bucket string, read, write bool, docs entryDocs) specItem {
+	access := []string{}
+	if read {
+		access = append(access, "read")
+	}
+	if write {
+		access = append(access, "write")
+	}
+	item := specItem{
+		kind:        specKindS3Bucket,
+		name:        bucket,
+		envVar:      "DEPLOY_ENV",
+		required:    true,
+		description: "S3 bucket (" + strings.Join(access, ", ") + ")",
+		deprecated:  docs.Deprecated,
+		value:       Id("c").Dot("AwsResources").Dot("S3" + toPublicVar(bucket)),
+	}
+	if docs.Description != "" {
+		item.description = docs.Description
+	}
+	return item
+}
+
+// s3BucketDocs are a bucket's docs. A bucket listed under both read and write can be documented in either.
+func s3BucketDocs(t LaunchYML, bucket string) entryDocs {
+	docs := entryDocs{}
+	for _, e := range append(append([]namedEntry{}, t.Aws.S3.Read...), t.Aws.S3.Write...) {
+		if e.Name != bucket {
+			continue
+		}
+		if docs.Description == "" {
+			docs.Description = e.Description
+		}
+		if docs.Deprecated == "" {
+			docs.Deprecated = e.Deprecated
+		}
+	}
+	return docs
+}
+
+// s3BucketNames returns the sorted, de-duplicated read and write buckets
+func s3BucketNames(t LaunchYML) []string {
+	s3Buckets := map[string]struct{}{}
+	for _, bucket := range t.Aws.S3.Read {
+		s3Buckets[bucket.Name] = struct{}{}
+	}
+	for _, bucket := range t.Aws.S3.Write {
+		s3Buckets[bucket.Name] = struct{}{}
+	}
+	return sortedKeys(s3Buckets)
+}
+
+// fargateSpec lists the configuration declared in a launch YML
+func fargateSpec(t LaunchYML, skip map[string]bool) []specItem {
+	items := dependencySpecs(t.Dependencies, skip)
+	for _, e := range t.Env {
+		item := envVarSpec(e.Name, !contains(optionalEnvVars, e.Name), false)
+		item.description = e.Description
+		item.deprecated = e.Deprecated
+		item.value = envFieldPath(e.Name, entryNames(t.EnvGroups))
+		items = append(items, item)
+	}
+	for _, bucket := range s3BucketNames(t) {
+		items = append(items, s3BucketSpec(bucket, contains(entryNames(t.Aws.S3.Read), bucket), contains(entryNames(t.Aws.S3.Write), bucket), s3BucketDocs(t, bucket)))
+	}
+	for _, s := range t.ExternalUrlUsage {
+		items = append(items, externalURLSpec(s))
+	}
+	return append(items, datastoreSpecs(t.Datastores)...)
+}
+
+func generateFargate(opts options, data []byte, output io.Writer) error {
 	t := LaunchYML{}
 	if err := yaml.Unmarshal(data, &t); err != nil {
 		return err
 	}
+	if err := validateExposedPorts(t.Expose); err != nil {
+		return err
+	}
+	if err := validateDatastores(t.Datastores); err != nil {
+		return err
+	}
+	if err := validateEnvGroups(entryNames(t.Env), entryNames(t.EnvGroups)); err != nil {
+		return err
+	}
 
-	f := NewFile(packageName)
+	f := NewFile(opts.packageName)
 	f.Comment("Code generated by launch-gen DO NOT EDIT.")
 	f.Id("")
 
 	f.Comment("LaunchConfig is auto-generated based on the launch YML file")
-	f.Type().Id("LaunchConfig").Struct(
-		Id("Deps").Id("Dependencies"),
-		Id("Env").Id("Environment"),
-		Id("AwsResources"),
-		Id("ExternalUrlUsage"),
-	)
+	f.Type().Id("LaunchConfig").StructFunc(func(g *Group) {
+		g.Id("Deps").Id("Dependencies")
+		g.Id("Env").Id("Environment")
+		g.Id("AwsResources")
+		g.Id("ExternalUrlUsage")
+		if len(t.Expose) > 0 {
+			g.Id("Expose").Id("Expose")
+		}
+		if len(t.Datastores) > 0 {
+			g.Id("Datastores").Id("Datastores")
+		}
+		g.Id("closers").Op("*").Id("closers")
+	})
 
-	overrideDependenciesMap := parseOverrideDependencies(&overrideDependenciesString, t.Dependencies)
+	overrideDependenciesMap, err := parseOverrides(opts, t.Dependencies)
+	if err != nil {
+		return err
+	}
 
-	depsInitDict, depInitLines := generateDependencies(f, t.Dependencies, skipDependencies, overrideDependenciesMap)
+	depsInitDict, depTasks := generateDependencies(f, t.Dependencies, overrideDependenciesMap, opts)
 
 	// Environment
-	envStruct := []Code{}
-	envInitDict := Dict{}
-	optionalEnvVars := []string{
-		// Not used in dev
-		"TRACING_ACCESS_TOKEN",
-	}
-	for _, s := range t.Env {
-		envStruct = append(envStruct, List(Id(toPublicVar(s))).String())
-		if contains(optionalEnvVars, s) {
-			envInitDict[Id(toPublicVar(s))] = Id("os.Getenv").Call(Lit(s))
-		} else {
-			envInitDict[Id(toPublicVar(s))] = Id("requireEnvVar").Call(Lit(s))
-		}
-	}
-
-	f.Comment("Environment has environment variables and their values")
-	f.Type().Id("Environment").Struct(envStruct...)
+	envInitDict := emitEnvironment(f, t.Env, t.EnvGroups, opts)
 
 	// AWS Resources
 	awsStruct := []Code{}
 	awsInitDict := Dict{}
 
-	s3Buckets := map[string]struct{}{}
-	for _, bucket := range t.Aws.S3.Read {
-		s3Buckets[bucket] = struct{}{}
-	}
-	for _, bucket := range t.Aws.S3.Write {
-		s3Buckets[bucket] = struct{}{}
-	}
-
-	for _, a := range sortedKeys(s3Buckets) {
+	for _, a := range s3BucketNames(t) {
 		name := "S3" + toPublicVar(a)
+		awsStruct = append(awsStruct, s3BucketDocs(t, a).comments()...)
 		awsStruct = append(awsStruct, List(Id(name)).String())
 		awsInitDict[Id(name)] = Id(funcGetS3NameByEnv).Call(Lit(a))
 	}
@@ -101,53 +174,82 @@ func generateFargate(packageName string, skipDependencies map[string]bool, overr
 	// External URL usage
 	externalUrlStruct := []Code{}
 	externalUrlInitDict := Dict{}
-	for _, s := range t.ExternalUrlUsage {
-		externalUrlStruct = append(externalUrlStruct, List(Id(toPublicVar(s))).String())
-		externalUrlInitDict[Id(toPublicVar(s))] = Id(toPrivateVar(s))
+	for _, e := range t.ExternalUrlUsage {
+		externalUrlStruct = append(externalUrlStruct, e.comments()...)
+		externalUrlStruct = append(externalUrlStruct, List(Id(toPublicVar(e.Name))).String())
+		externalUrlInitDict[Id(toPublicVar(e.Name))] = Id(toPrivateVar(e.Name))
 	}
 
 	f.Comment("ExternalUrlUsage uses discovery to generate urls for external services")
 	f.Type().Id("ExternalUrlUsage").Struct(externalUrlStruct...)
 
-	lines := depInitLines
+	discoveryReqs := startupDiscoveryRequirements(fargateSpec(t, opts.skipDependencies), opts)
+	deprecated := deprecatedEnvVars(fargateSpec(t, opts.skipDependencies))
+	preamble := append(loadLocalEnvFileLines(opts), warnDeprecatedEnvVarsLines(deprecated)...)
+	preamble = append(preamble, requireDiscoveryLines(discoveryReqs, opts)...)
+	preamble = append(preamble, checkRequiredEnvVarsLines(fargateSpec(t, opts.skipDependencies), opts)...)
+	preamble = append(preamble, initOptionsLines(depTasks)...)
 
-	for _, s := range t.ExternalUrlUsage {
-		c := []Code{
-			List(Id(toPrivateVar(s)), Err()).Op(":=").
-				Qual("github.com/Clever/discovery-go", "ExternalURL").
-				Call(Lit(s)),
-			If(Err().Op("!=").Nil()).Block(
-				Qual("log", "Fatalf").Call(List(Lit("discovery error: %s"), Err())),
-			),
-		}
-		lines = append(lines, c...)
+	tasks := startupDependencyTasks(depTasks, opts)
+	for _, e := range entryNames(t.ExternalUrlUsage) {
+		tasks = append(tasks, initTask{
+			name:    e,
+			varName: toPrivateVar(e),
+			varType: String(),
+			call:    Qual("github.com/Clever/discovery-go", "ExternalURL").Call(Lit(e)),
+		})
 	}
 
-	ret := Return(Id("LaunchConfig").Values(Dict{
+	config := Dict{
 		Id("Deps"):             Id("Dependencies").Values(depsInitDict),
 		Id("Env"):              Id("Environment").Values(envInitDict),
 		Id("AwsResources"):     Id("AwsResources").Values(awsInitDict),
 		Id("ExternalUrlUsage"): Id("ExternalUrlUsage").Values(externalUrlInitDict),
-	}))
-	lines = append(lines, ret)
+	}
+	if len(t.Expose) > 0 {
+		config[Id("Expose")] = Id("Expose").Values(emitExpose(f, t.Expose))
+	}
+	if len(t.Datastores) > 0 {
+		config[Id("Datastores")] = Id("Datastores").Values(emitDatastores(f, t.Datastores, opts))
+	}
+
+	emitInitLaunchConfig(f, opts, preamble, tasks, Id("LaunchConfig").Values(withClosers(config, depTasks)))
 
-	f.Comment("InitLaunchConfig creates a LaunchConfig")
-	initLaunchConfigParams := []Code{Id("exp *").Qual("go.opentelemetry.io/otel/sdk/trace", "SpanExporter")}
-	f.Func().Id("InitLaunchConfig").Params(initLaunchConfigParams...).Id("LaunchConfig").Block(lines...)
+	emitInitOptions(f, t.App.Name != "")
+	emitClose(f)
+	emitFatal(f, opts)
+	emitDeployEnv(f)
+	emitWarnDeprecatedEnvVars(f, deprecated, opts)
+	emitDependencyStatus(f, startupDependencyTasks(depTasks, opts))
+	emitResource(f, t.App, fargateResourceAttributes)
+	emitDependencyHelpers(f, depTasks)
+	if opts.health {
+		emitCheckHealth(f, depTasks, opts)
+	}
+	if opts.lazy {
+		emitMustLaunchConfig(f)
+	}
+	emitRequireEnvVar(f, opts, nil)
+	if opts.flags {
+		emitRegisterFlags(f, append(entryNames(t.Env), datastoreEnvVars(t.Datastores)...))
+	}
+	emitRequireDiscoveryEnvVars(f, discoveryReqs, opts)
+	emitCheckRequiredEnvVars(f, fargateSpec(t, opts.skipDependencies), opts)
+	if opts.dotenv {
+		emitLoadLocalEnvFile(f, opts)
+	}
 
-	emitRequireEnvVar(f)
+	if opts.spec {
+		emitLaunchSpec(f, fargateSpec(t, opts.skipDependencies), opts)
+	}
 
 	f.Comment(`getS3NameByEnv adds "-dev" to an env var name unless we're in "production" deploy env, and appends _POD_ACCOUNT if the account is in podAccountSuffixMap`)
-	f.Comment(`We check both DEPLOY_ENV and _DEPLOY_ENV env vars, which are injected by our deployment system for Lambda and non-Lambda deployments, respectively`)
 	f.Func().Id(funcGetS3NameByEnv).Params(Id("s").String()).String().Block(
-		Id("env").Op(":=").Qual("os", "Getenv").Call(Lit("DEPLOY_ENV")),
-		If(Id("env").Op("==").Lit("")).Block(
-			Id("env").Op("=").Qual("os", "Getenv").Call(Lit("_DEPLOY_ENV")),
-		),
+		Id("env").Op(":=").Add(currentDeployEnv()),
 		If(Id("env").Op("==").Lit("")).Block(
-			Qual("log", "Fatal").Call(List(Lit("Unable to determine deployment environment (DEPLOY_ENV and _DEPLOY_ENV are undefined)"))),
+			fatalCall(opts, "unknown-deploy-env", Dict{Lit("missing_env_var"): Lit("DEPLOY_ENV")}, "Unable to determine deployment environment (DEPLOY_ENV and _DEPLOY_ENV are undefined)"),
 		),
-		If(Id("env").Op("==").Lit("production")).Block(
+		If(Id("env").Dot("IsProduction").Call()).Block(
 			Return(Id("s")),
 		),
 		Id("podAccount").Op(":=").Qual("os", "Getenv").Call(Lit("_POD_ACCOUNT")),
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// log formats for -log-format. By default, generated code calls log.Fatalf directly.
+const (
+	logFormatText   = "text"
+	logFormatKayvee = "kayvee"
+)
+
+// validateLogFormat checks a -log-format value
+func validateLogFormat(format string) error {
+	switch format {
+	case "", logFormatText, logFormatKayvee:
+		return nil
+	}
+	return fmt.Errorf("invalid -log-format %q, must be %s or %s", format, logFormatText, logFormatKayvee)
+}
+
+// fatalCall exits the program with a message built from format and args. With a -log-format, it goes
+// through the generated fatal, which also gets a kayvee title and structured fields.
+func fatalCall(opts options, title string, fields jen.Dict, format string, args ...jen.Code) jen.Code {
+	if opts.logFormat == "" {
+		if len(args) == 0 {
+			return jen.Qual("log", "Fatal").Call(jen.Lit(format))
+		}
+		return jen.Qual("log", "Fatalf").Call(append([]jen.Code{jen.Lit(format)}, args...)...)
+	}
+	msg := jen.Code(jen.Lit(format))
+	if len(args) > 0 {
+		msg = jen.Qual("fmt", "Sprintf").Call(append([]jen.Code{jen.Lit(format)}, args...)...)
+	}
+	return jen.Id("fatal").Call(jen.Lit(title), msg, jen.Map(jen.String()).Interface().Values(fields))
+}
+
+// missingEnvVarFatal is how requireEnvVar exits the program
+func missingEnvVarFatal(opts options) jen.Code {
+	return fatalCall(opts, "missing-env-var", jen.Dict{jen.Lit("missing_env_var"): jen.Id("s")}, "env var %s is not defined", jen.Id("s"))
+}
+
+// emitFatal writes FatalLogger, Exit and fatal, if a -log-format is set
+func emitFatal(f *jen.File, opts options) {
+	if opts.logFormat == "" {
+		return
+	}
+
+	defaultLogger := "logText"
+	if opts.logFormat == logFormatKayvee {
+		defaultLogger = "logKayvee"
+	}
+	f.Comment("FatalLogger logs an error that stops the program, with a short title, a message and structured fields.")
+	f.Comment("Replace it to route these errors through your own logger.")
+	f.Var().Id("FatalLogger").Op("=").Id(defaultLogger)
+
+	f.Comment("Exit is called with 1 after FatalLogger. Tests can replace it, e.g. with a function that panics.")
+	f.Var().Id("Exit").Op("=").Qual("os", "Exit")
+
+	f.Comment("fatal logs an error with FatalLogger, then calls Exit")
+	f.Func().Id("fatal").Params(jen.List(jen.Id("title"), jen.Id("msg")).String(), jen.Id("fields").Map(jen.String()).Interface()).Block(
+		jen.Id("FatalLogger").Call(jen.Id("title"), jen.Id("msg"), jen.Id("fields")),
+		jen.Id("Exit").Call(jen.Lit(1)),
+	)
+
+	f.Comment("logText logs msg with the standard logger")
+	f.Func().Id("logText").Params(jen.List(jen.Id("title"), jen.Id("msg")).String(), jen.Id("fields").Map(jen.String()).Interface()).Block(
+		jen.Qual("log", "Print").Call(jen.Id("msg")),
+	)
+
+	f.Comment("logKayvee writes a kayvee JSON line to stderr")
+	f.Func().Id("logKayvee").Params(jen.List(jen.Id("title"), jen.Id("msg")).String(), jen.Id("fields").Map(jen.String()).Interface()).Block(
+		jen.Id("line").Op(":=").Map(jen.String()).Interface().Values(),
+		jen.For(jen.List(jen.Id("k"), jen.Id("v")).Op(":=").Range().Id("fields")).Block(
+			jen.Id("line").Index(jen.Id("k")).Op("=").Id("v"),
+		),
+		jen.Id("line").Index(jen.Lit("level")).Op("=").Lit("critical"),
+		jen.Id("line").Index(jen.Lit("title")).Op("=").Id("title"),
+		jen.Id("line").Index(jen.Lit("msg")).Op("=").Id("msg"),
+		jen.List(jen.Id("data"), jen.Id("_")).Op(":=").Qual("encoding/json", "Marshal").Call(jen.Id("line")),
+		jen.Qual("fmt", "Fprintln").Call(jen.Qual("os", "Stderr"), jen.String().Call(jen.Id("data"))),
+	)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// value sources recorded by the generated lookupEnvVar
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceDefault = "default"
+)
+
+// toFlagName turns an env var into a command-line flag name
+// FOO_BAR => foo-bar
+func toFlagName(envVar string) string {
+	return strings.ReplaceAll(strings.ToLower(envVar), "_", "-")
+}
+
+// emitRegisterFlags writes RegisterFlags, which registers one flag per env var in Environment or Datastores
+func emitRegisterFlags(f *jen.File, envVars []string) {
+	f.Comment("flagValues holds the env var values set by flags registered with RegisterFlags")
+	f.Var().Id("flagValues").Op("=").Map(jen.String()).String().Values()
+
+	f.Comment("RegisterFlags registers a flag per Environment and Datastores env var, named after it, e.g. -env-var-a for ENV_VAR_A.")
+	f.Comment("Values resolve in the order flag > env var > default. Call it before fs.Parse and InitLaunchConfig.")
+	f.Func().Id("RegisterFlags").Params(jen.Id("fs").Op("*").Qual("flag", "FlagSet")).BlockFunc(func(g *jen.Group) {
+		for _, envVar := range envVars {
+			g.Id("fs").Dot("Func").Call(jen.Lit(toFlagName(envVar)), jen.Lit("overrides the "+envVar+" env var"), jen.Id("setFlagValue").Call(jen.Lit(envVar)))
+		}
+	})
+
+	f.Comment("setFlagValue records a flag's value for lookupEnvVar")
+	f.Func().Id("setFlagValue").Params(jen.Id("envVar").String()).Func().Params(jen.String()).Error().Block(
+		jen.Return(jen.Func().Params(jen.Id("s").String()).Error().Block(
+			jen.Id("flagValues").Index(jen.Id("envVar")).Op("=").Id("s"),
+			jen.Return(jen.Nil()),
+		)),
+	)
+}
+
+// emitEnvVarDefaults writes envVarDefaults, the values.yaml values that env var lookups fall back to
+func emitEnvVarDefaults(f *jen.File, defaults map[string]string) {
+	defaultsDict := jen.Dict{}
+	for envVar, value := range defaults {
+		defaultsDict[jen.Lit(envVar)] = jen.Lit(value)
+	}
+	f.Comment("envVarDefaults are the env var values from values.yaml, used when an env var isn't otherwise set")
+	f.Var().Id("envVarDefaults").Op("=").Map(jen.String()).String().Values(defaultsDict)
+}
+
+// lookupEnvVarFunc is the function that reports whether an env var is set: by flag or in the environment
+// with -flags, or else in the environment
+func lookupEnvVarFunc(opts options) jen.Code {
+	if opts.flags {
+		return jen.Id("lookupEnvVar")
+	}
+	return jen.Qual("os", "LookupEnv")
+}
+
+// emitFlagAwareEnvVarLookups writes the env var lookups used with RegisterFlags, which check flags,
+// then the environment, then the values.yaml defaults, and record where each value came from
+func emitFlagAwareEnvVarLookups(f *jen.File, opts options, defaults map[string]string) {
+	emitEnvVarDefaults(f, defaults)
+
+	f.Comment("valueSources records whether each env var was read from a flag, the environment, or its default. It is guarded by")
+	f.Comment("valueSourcesMu, since lazy accessors and concurrent init read env vars from several goroutines.")
+	f.Var().Defs(
+		jen.Id("valueSourcesMu").Qual("sync", "Mutex"),
+		jen.Id("valueSources").Op("=").Map(jen.String()).String().Values(),
+	)
+
+	f.Comment("ValueSource reports whether an env var's value came from a \"" + sourceFlag + "\", the \"" + sourceEnv + "\", or its \"" + sourceDefault + "\"")
+	f.Func().Id("ValueSource").Params(jen.Id("envVar").String()).String().Block(
+		jen.Id("valueSourcesMu").Dot("Lock").Call(),
+		jen.Defer().Id("valueSourcesMu").Dot("Unlock").Call(),
+		jen.Return(jen.Id("valueSources").Index(jen.Id("envVar"))),
+	)
+
+	f.Comment("setValueSource records where an env var's value came from")
+	f.Func().Id("setValueSource").Params(jen.Id("envVar"), jen.Id("source").String()).Block(
+		jen.Id("valueSourcesMu").Dot("Lock").Call(),
+		jen.Defer().Id("valueSourcesMu").Dot("Unlock").Call(),
+		jen.Id("valueSources").Index(jen.Id("envVar")).Op("=").Id("source"),
+	)
+
+	f.Comment("lookupEnvVar reads an env var set by flag, falling back to the environment")
+	f.Func().Id("lookupEnvVar").Params(jen.Id("s").String()).Params(jen.String(), jen.Bool()).Block(
+		jen.If(jen.List(jen.Id("val"), jen.Id("ok")).Op(":=").Id("flagValues").Index(jen.Id("s")), jen.Id("ok")).Block(
+			jen.Id("setValueSource").Call(jen.Id("s"), jen.Lit(sourceFlag)),
+			jen.Return(jen.Id("val"), jen.True()),
+		),
+		jen.If(jen.List(jen.Id("val"), jen.Id("ok")).Op(":=").Qual("os", "LookupEnv").Call(jen.Id("s")), jen.Id("ok")).Block(
+			jen.Id("setValueSource").Call(jen.Id("s"), jen.Lit(sourceEnv)),
+			jen.Return(jen.Id("val"), jen.True()),
+		),
+		jen.Return(jen.Lit(""), jen.False()),
+	)
+
+	f.Comment("lookupEnvVarOrDefault reads an env var set by flag or in the environment, falling back to its default")
+	f.Func().Id("lookupEnvVarOrDefault").Params(jen.Id("s").String()).Params(jen.String(), jen.Bool()).Block(
+		jen.If(jen.List(jen.Id("val"), jen.Id("ok")).Op(":=").Id("lookupEnvVar").Call(jen.Id("s")), jen.Id("ok")).Block(
+			jen.Return(jen.Id("val"), jen.True()),
+		),
+		jen.Id("setValueSource").Call(jen.Id("s"), jen.Lit(sourceDefault)),
+		jen.List(jen.Id("val"), jen.Id("ok")).Op(":=").Id("envVarDefaults").Index(jen.Id("s")),
+		jen.Return(jen.Id("val"), jen.Id("ok")),
+	)
+
+	f.Comment(`requireEnvVar exits the program immediately if an env var is not set by flag, in the environment or by default`)
+	f.Func().Id("requireEnvVar").Params(jen.Id("s").String()).String().Block(
+		jen.List(jen.Id("val"), jen.Id("present")).Op(":=").Id("lookupEnvVarOrDefault").Call(jen.Id("s")),
+		jen.If(jen.Op("!").Id("present")).Block(
+			missingEnvVarFatal(opts),
+		),
+		jen.Return(jen.Id("val")),
+	)
+
+	f.Comment(`optionalEnvVar returns an env var set by flag, in the environment or by default, or else ""`)
+	f.Func().Id("optionalEnvVar").Params(jen.Id("s").String()).String().Block(
+		jen.List(jen.Id("val"), jen.Id("_")).Op(":=").Id("lookupEnvVarOrDefault").Call(jen.Id("s")),
+		jen.Return(jen.Id("val")),
+	)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// defaultHealthCheckTimeout is the generated HealthCheckTimeout
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// healthCheckFunc is a func(context.Context) error that checks a dependency. wag clients are checked
+// with their HealthCheck endpoint, http dependencies with a GET of their base URL, and grpc
+// dependencies by opening a TCP connection to their target.
+func healthCheckFunc(t initTask, opts options) jen.Code {
+	client := jen.Id("d").Dot(toPublicVar(t.name))
+	return jen.Func().Params(jen.Id("ctx").Qual("context", "Context")).Error().BlockFunc(func(g *jen.Group) {
+		if opts.lazy {
+			g.List(jen.Id("c"), jen.Err()).Op(":=").Id("d").Dot(toPublicVar(t.name)).Call()
+			g.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			)
+			client = jen.Id("c")
+		} else if t.optional {
+			g.If(client.Clone().Op("==").Nil()).Block(
+				jen.Return(jen.Qual("errors", "New").Call(jen.Lit("optional dependency " + t.name + " is unavailable"))),
+			)
+		}
+		switch t.kind {
+		case dependencyKindHTTP:
+			g.Return(jen.Id("probeURL").Call(jen.Id("ctx"), client))
+		case dependencyKindGRPC:
+			g.Return(jen.Id("probeTCP").Call(jen.Id("ctx"), client.Clone().Dot("Target").Call()))
+		default:
+			g.Return(client.Clone().Dot("HealthCheck").Call(jen.Id("ctx")))
+		}
+	})
+}
+
+// emitCheckHealth writes CheckHealth and HealthHandler on Dependencies, and the probes they use
+func emitCheckHealth(f *jen.File, depTasks []initTask, opts options) {
+	checks := jen.Dict{}
+	optional := jen.Dict{}
+	kinds := map[string]bool{}
+	for _, t := range depTasks {
+		checks[jen.Lit(t.name)] = healthCheckFunc(t, opts)
+		if t.optional {
+			optional[jen.Lit(t.name)] = jen.True()
+		}
+		kinds[t.kind] = true
+	}
+
+	f.Comment("HealthCheckTimeout bounds how long CheckHealth waits for dependencies")
+	f.Var().Id("HealthCheckTimeout").Op("=").Add(durationExpr(defaultHealthCheckTimeout))
+
+	f.Comment("CheckHealth checks every dependency concurrently, and returns each one's error, or nil if it is healthy")
+	f.Func().Params(jen.Id("d").Id("Dependencies")).Id("CheckHealth").Params(jen.Id("ctx").Qual("context", "Context")).Map(jen.String()).Error().Block(
+		jen.List(jen.Id("ctx"), jen.Id("cancel")).Op(":=").Qual("context", "WithTimeout").Call(jen.Id("ctx"), jen.Id("HealthCheckTimeout")),
+		jen.Defer().Id("cancel").Call(),
+		jen.Id("checks").Op(":=").Map(jen.String()).Func().Params(jen.Qual("context", "Context")).Error().Values(checks),
+		jen.Id("results").Op(":=").Make(jen.Map(jen.String()).Error(), jen.Len(jen.Id("checks"))),
+		jen.Var().Id("mu").Qual("sync", "Mutex"),
+		jen.Var().Id("wg").Qual("sync", "WaitGroup"),
+		jen.For(jen.List(jen.Id("name"), jen.Id("check")).Op(":=").Range().Id("checks")).Block(
+			jen.Id("wg").Dot("Add").Call(jen.Lit(1)),
+			jen.Go().Func().Params(jen.Id("name").String(), jen.Id("check").Func().Params(jen.Qual("context", "Context")).Error()).Block(
+				jen.Defer().Id("wg").Dot("Done").Call(),
+				jen.Err().Op(":=").Id("check").Call(jen.Id("ctx")),
+				jen.Id("mu").Dot("Lock").Call(),
+				jen.Id("results").Index(jen.Id("name")).Op("=").Err(),
+				jen.Id("mu").Dot("Unlock").Call(),
+			).Call(jen.Id("name"), jen.Id("check")),
+		),
+		jen.Id("wg").Dot("Wait").Call(),
+		jen.Return(jen.Id("results")),
+	)
+
+	if len(optional) > 0 {
+		f.Comment("optionalDependencies don't fail HealthHandler")
+		f.Var().Id("optionalDependencies").Op("=").Map(jen.String()).Bool().Values(optional)
+	}
+
+	failStatus := jen.Id("status").Op("=").Qual("net/http", "StatusServiceUnavailable")
+	if len(optional) > 0 {
+		failStatus = jen.If(jen.Op("!").Id("optionalDependencies").Index(jen.Id("name"))).Block(failStatus)
+	}
+	f.Comment("HealthHandler serves CheckHealth's results as JSON, for readiness probes. It responds 503 if a required")
+	f.Comment("dependency is unhealthy.")
+	f.Func().Params(jen.Id("d").Id("Dependencies")).Id("HealthHandler").Params().Qual("net/http", "Handler").Block(
+		jen.Return(jen.Qual("net/http", "HandlerFunc").Call(jen.Func().Params(jen.Id("w").Qual("net/http", "ResponseWriter"), jen.Id("r").Op("*").Qual("net/http", "Request")).Block(
+			jen.Id("status").Op(":=").Qual("net/http", "StatusOK"),
+			jen.Id("body").Op(":=").Map(jen.String()).String().Values(),
+			jen.For(jen.List(jen.Id("name"), jen.Err()).Op(":=").Range().Id("d").Dot("CheckHealth").Call(jen.Id("r").Dot("Context").Call())).Block(
+				jen.If(jen.Err().Op("==").Nil()).Block(
+					jen.Id("body").Index(jen.Id("name")).Op("=").Lit("ok"),
+					jen.Continue(),
+				),
+				jen.Id("body").Index(jen.Id("name")).Op("=").Err().Dot("Error").Call(),
+				failStatus,
+			),
+			jen.Id("w").Dot("Header").Call().Dot("Set").Call(jen.Lit("Content-Type"), jen.Lit("application/json")),
+			jen.Id("w").Dot("WriteHeader").Call(jen.Id("status")),
+			jen.Qual("encoding/json", "NewEncoder").Call(jen.Id("w")).Dot("Encode").Call(jen.Id("body")),
+		))),
+	)
+
+	if kinds[dependencyKindHTTP] {
+		f.Comment("probeURL checks that a GET of u doesn't fail or respond with a server error")
+		f.Func().Id("probeURL").Params(jen.Id("ctx").Qual("context", "Context"), jen.Id("u").Op("*").Qual("net/url", "URL")).Error().Block(
+			jen.List(jen.Id("req"), jen.Err()).Op(":=").Qual("net/http", "NewRequestWithContext").Call(jen.Id("ctx"), jen.Qual("net/http", "MethodGet"), jen.Id("u").Dot("String").Call(), jen.Nil()),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			),
+			jen.List(jen.Id("resp"), jen.Err()).Op(":=").Qual("net/http", "DefaultClient").Dot("Do").Call(jen.Id("req")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			),
+			jen.Id("resp").Dot("Body").Dot("Close").Call(),
+			jen.If(jen.Id("resp").Dot("StatusCode").Op(">=").Lit(500)).Block(
+				jen.Return(jen.Qual("fmt", "Errorf").Call(jen.Lit("%s responded %s"), jen.Id("u"), jen.Id("resp").Dot("Status"))),
+			),
+			jen.Return(jen.Nil()),
+		)
+	}
+
+	if kinds[dependencyKindGRPC] {
+		f.Comment("probeTCP checks that a TCP connection can be opened to address")
+		f.Func().Id("probeTCP").Params(jen.Id("ctx").Qual("context", "Context"), jen.Id("address").String()).Error().Block(
+			jen.List(jen.Id("conn"), jen.Err()).Op(":=").Parens(jen.Op("&").Qual("net", "Dialer").Values()).Dot("DialContext").Call(jen.Id("ctx"), jen.Lit("tcp"), jen.Id("address")),
+			jen.If(jen.Err().Op("!=").Nil()).Block(
+				jen.Return(jen.Err()),
+			),
+			jen.Return(jen.Id("conn").Dot("Close").Call()),
+		)
+	}
+}
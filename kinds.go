@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/dave/jennifer/jen"
+)
+
+// dependency kinds, set with a dependency's kind
+const (
+	dependencyKindWag  = "wag"
+	dependencyKindHTTP = "http"
+	dependencyKindGRPC = "grpc"
+)
+
+// dependencyExposes are the discovery exposes tried, in order, for each kind of dependency. wag's
+// NewFromDiscovery tries "default", then "http".
+var dependencyExposes = map[string][]string{
+	dependencyKindWag:  {"default", "http"},
+	dependencyKindHTTP: {"default", "http"},
+	dependencyKindGRPC: {"grpc", "default"},
+}
+
+// dependencyDescriptions describe each kind of dependency in the generated LaunchSpec
+var dependencyDescriptions = map[string]string{
+	dependencyKindWag:  "wag client for ",
+	dependencyKindHTTP: "HTTP base URL for ",
+	dependencyKindGRPC: "gRPC connection to ",
+}
+
+// kind is the dependency's kind, defaulting to wag
+func (d dependency) kind() string {
+	if d.Kind == "" {
+		return dependencyKindWag
+	}
+	return d.Kind
+}
+
+// dependencyInitTask creates a dependency's client, URL or connection, according to its kind
+func dependencyInitTask(d dependency, overrides map[string]dependencyOverride, opts options) initTask {
+	t := initTask{
+		name:     d.Name,
+		varName:  toPrivateVar(d.Name),
+		kind:     d.kind(),
+		optional: d.Optional,
+		docs:     d.entryDocs,
+	}
+	switch d.kind() {
+	case dependencyKindHTTP:
+		t.varType = jen.Op("*").Qual("net/url", "URL")
+		t.call = jen.Id("discoverURL").Call(jen.Lit(d.Name))
+	case dependencyKindGRPC:
+		t.varType = jen.Op("*").Qual("google.golang.org/grpc", "ClientConn")
+		t.call = jen.Id("dialGRPC").Call(jen.Lit(d.Name), jen.Lit(d.TLS), jen.Id("o"))
+	default:
+		clientPath := clientImportPath(d, overrides)
+		clientconfigImport, clientconfigFunc := opts.clientconfig()
+		constructor, tracingName := "NewFromDiscovery", d.Name
+		if o := overrides[d.Name]; o.constructor != "" {
+			constructor = o.constructor
+		}
+		if o := overrides[d.Name]; o.tracingName != "" {
+			tracingName = o.tracingName
+		}
+		t.clientPath = clientPath
+		t.varType = jen.Qual(clientPath, "Client")
+		t.clientconfigCall = jen.Qual(clientconfigImport, clientconfigFunc).Call(jen.Lit(tracingName))
+		t.constructorCall = jen.Qual(clientPath, constructor).Call(jen.Id("httpClient"), jen.Id("logger"))
+		t.call = jen.Id(clientConstructorName(d.Name)).Call(jen.Id("o"))
+		t.settings = clientSettings(d, clientPath)
+	}
+	return t
+}
+
+// exposesLit is the generated list of exposes for a kind of dependency
+func exposesLit(kind string) jen.Code {
+	return jen.Index().String().ValuesFunc(func(g *jen.Group) {
+		for _, expose := range dependencyExposes[kind] {
+			g.Lit(expose)
+		}
+	})
+}
+
+// emitDependencyHelpers writes the wag client constructors, discoverURL and dialGRPC, if a dependency uses them
+func emitDependencyHelpers(f *jen.File, depTasks []initTask) {
+	kinds := map[string]bool{}
+	for _, t := range depTasks {
+		kinds[t.kind] = true
+	}
+
+	if kinds[dependencyKindWag] {
+		for _, t := range depTasks {
+			if t.kind == dependencyKindWag {
+				emitClientConstructor(f, t)
+			}
+		}
+		emitInstrumentHTTPClient(f)
+	}
+
+	if kinds[dependencyKindHTTP] {
+		f.Comment("discoverURL finds a service's base URL through discovery, trying each of its exposes in turn")
+		f.Func().Id("discoverURL").Params(jen.Id("service").String()).Params(jen.Op("*").Qual("net/url", "URL"), jen.Error()).Block(
+			jen.Var().Err().Error(),
+			jen.For(jen.List(jen.Id("_"), jen.Id("expose")).Op(":=").Range().Add(exposesLit(dependencyKindHTTP))).Block(
+				jen.Var().Id("u").String(),
+				jen.If(jen.List(jen.Id("u"), jen.Err()).Op("=").Qual("github.com/Clever/discovery-go", "URL").Call(jen.Id("service"), jen.Id("expose")), jen.Err().Op("==").Nil()).Block(
+					jen.Return(jen.Qual("net/url", "Parse").Call(jen.Id("u"))),
+				),
+			),
+			jen.Return(jen.Nil(), jen.Err()),
+		)
+	}
+
+	if kinds[dependencyKindGRPC] {
+		f.Comment("dialGRPC connects to a service found through discovery, trying each of its exposes in turn, over TLS if useTLS")
+		f.Comment("is set. Calls are traced with o's shared tracer provider.")
+		f.Func().Id("dialGRPC").Params(jen.Id("service").String(), jen.Id("useTLS").Bool(), jen.Id("o").Id("initOptions")).Params(jen.Op("*").Qual("google.golang.org/grpc", "ClientConn"), jen.Error()).BlockFunc(func(g *jen.Group) {
+			for _, line := range otelOptionsLines(otelgrpcPath) {
+				g.Add(line)
+			}
+			g.Var().Id("creds").Qual("google.golang.org/grpc/credentials", "TransportCredentials").Op("=").Qual("google.golang.org/grpc/credentials/insecure", "NewCredentials").Call()
+			g.If(jen.Id("useTLS")).Block(
+				jen.Id("creds").Op("=").Qual("google.golang.org/grpc/credentials", "NewTLS").Call(jen.Op("&").Qual("crypto/tls", "Config").Values()),
+			)
+			g.Var().Err().Error()
+			g.For(jen.List(jen.Id("_"), jen.Id("expose")).Op(":=").Range().Add(exposesLit(dependencyKindGRPC))).Block(
+				jen.Var().Id("target").String(),
+				jen.If(jen.List(jen.Id("target"), jen.Err()).Op("=").Qual("github.com/Clever/discovery-go", "HostPort").Call(jen.Id("service"), jen.Id("expose")), jen.Err().Op("==").Nil()).Block(
+					jen.List(jen.Id("conn"), jen.Err()).Op(":=").Qual("google.golang.org/grpc", "NewClient").Custom(jen.Options{Open: "(", Close: ")", Separator: ",", Multi: true},
+						jen.Id("target"),
+						jen.Qual("google.golang.org/grpc", "WithTransportCredentials").Call(jen.Id("creds")),
+						jen.Qual("google.golang.org/grpc", "WithStatsHandler").Call(jen.Qual(otelgrpcPath, "NewClientHandler").Call(jen.Id("otelOpts").Op("..."))),
+					),
+					jen.If(jen.Err().Op("!=").Nil()).Block(
+						jen.Return(jen.Nil(), jen.Err()),
+					),
+					addCloser(jen.Func().Params(jen.Qual("context", "Context")).Error().Block(
+						jen.Return(jen.Id("conn").Dot("Close").Call()),
+					)),
+					jen.Return(jen.Id("conn"), jen.Nil()),
+				),
+			)
+			g.Return(jen.Nil(), jen.Err())
+		})
+	}
+}
@@ -9,15 +9,23 @@ import (
 )
 
 type envVar struct {
-	Name string `yaml:"name"`
+	Name      string `yaml:"name"`
+	Value     string `yaml:"value"`
+	entryDocs `yaml:",inline"`
 }
 
 // ValuesYML Schema
 type ValuesYML struct {
-	Env              []envVar `yaml:"env"`
-	Secrets          []envVar `yaml:"secrets"`
-	Dependencies     []string `yaml:"dependencies"`
-	ExternalUrlUsage []string `yaml:"externalUrlUsage"`
+	Env              []envVar           `yaml:"env"`
+	Secrets          []envVar           `yaml:"secrets"`
+	Dependencies     []dependency       `yaml:"dependencies"`
+	ExternalUrlUsage []namedEntry       `yaml:"externalUrlUsage"`
+	App              appMetadata        `yaml:"app"`
+	Resources        containerResources `yaml:"resources"`
+	Runtime          runtimeSection     `yaml:"runtime"`
+	Ports            []exposedPort      `yaml:"ports"`
+	Datastores       []datastore        `yaml:"datastores"`
+	EnvGroups        []namedEntry       `yaml:"envGroups"`
 }
 
 // toEnvVarName mirrors the chart's regexReplaceAll "[^A-Z0-9]" (upper $url) "_"
@@ -31,69 +39,169 @@ func toEnvVarName(s string) string {
 	}, upper)
 }
 
-func generateKubernetes(packageName string, skipDependencies map[string]bool, overrideDependenciesString string, data []byte, output io.Writer) error {
+func generateKubernetes(opts options, data []byte, output io.Writer) error {
 	t := ValuesYML{}
 	if err := yaml.Unmarshal(data, &t); err != nil {
 		return err
 	}
+	if err := validateExposedPorts(t.Ports); err != nil {
+		return err
+	}
+	if err := validateDatastores(t.Datastores); err != nil {
+		return err
+	}
+	if err := validateEnvGroups(envVarNames(t), entryNames(t.EnvGroups)); err != nil {
+		return err
+	}
 
-	f := NewFile(packageName)
+	f := NewFile(opts.packageName)
 	f.Comment("Code generated by launch-gen DO NOT EDIT.")
 	f.Id("")
 
 	f.Comment("LaunchConfig is auto-generated based on the values YAML file")
-	f.Type().Id("LaunchConfig").Struct(
-		Id("Deps").Id("Dependencies"),
-		Id("Env").Id("Environment"),
-		Id("ExternalUrlUsage"),
-	)
-
-	overrideDependenciesMap := parseOverrideDependencies(&overrideDependenciesString, t.Dependencies)
-	depsInitDict, depInitLines := generateDependencies(f, t.Dependencies, skipDependencies, overrideDependenciesMap)
-	envInitDict := generateEnvironment(f, t.Env, t.Secrets)
+	f.Type().Id("LaunchConfig").StructFunc(func(g *Group) {
+		g.Id("Deps").Id("Dependencies")
+		g.Id("Env").Id("Environment")
+		g.Id("ExternalUrlUsage")
+		if t.Runtime != nil {
+			g.Id("Runtime").Id("Runtime")
+		}
+		if len(t.Ports) > 0 {
+			g.Id("Expose").Id("Expose")
+		}
+		if len(t.Datastores) > 0 {
+			g.Id("Datastores").Id("Datastores")
+		}
+		g.Id("closers").Op("*").Id("closers")
+	})
+
+	overrideDependenciesMap, err := parseOverrides(opts, t.Dependencies)
+	if err != nil {
+		return err
+	}
+	depsInitDict, depTasks := generateDependencies(f, t.Dependencies, overrideDependenciesMap, opts)
+	envInitDict := emitEnvironment(f, envEntries(t), t.EnvGroups, opts)
 	externalUrlInitDict := generateExternalUrlUsage(f, t.ExternalUrlUsage)
 
-	lines := append(depInitLines, Return(Id("LaunchConfig").Values(Dict{
+	discoveryReqs := startupDiscoveryRequirements(kubernetesSpec(t, opts.skipDependencies), opts)
+	deprecated := deprecatedEnvVars(kubernetesSpec(t, opts.skipDependencies))
+	preamble := append(loadLocalEnvFileLines(opts), warnDeprecatedEnvVarsLines(deprecated)...)
+	preamble = append(preamble, requireDiscoveryLines(discoveryReqs, opts)...)
+	preamble = append(preamble, checkRequiredEnvVarsLines(kubernetesSpec(t, opts.skipDependencies), opts)...)
+	preamble = append(preamble, initOptionsLines(depTasks)...)
+
+	config := Dict{
 		Id("Deps"):             Id("Dependencies").Values(depsInitDict),
 		Id("Env"):              Id("Environment").Values(envInitDict),
 		Id("ExternalUrlUsage"): Id("ExternalUrlUsage").Values(externalUrlInitDict),
-	})))
+	}
+	if t.Runtime != nil {
+		config[Id("Runtime")] = Id("Runtime").Values(emitRuntime(f, t.Runtime, opts))
+	}
+	if len(t.Ports) > 0 {
+		config[Id("Expose")] = Id("Expose").Values(emitExpose(f, t.Ports))
+	}
+	if len(t.Datastores) > 0 {
+		config[Id("Datastores")] = Id("Datastores").Values(emitDatastores(f, t.Datastores, opts))
+	}
 
-	f.Comment("InitLaunchConfig creates a LaunchConfig")
-	initLaunchConfigParams := []Code{Id("exp *").Qual("go.opentelemetry.io/otel/sdk/trace", "SpanExporter")}
-	f.Func().Id("InitLaunchConfig").Params(initLaunchConfigParams...).Id("LaunchConfig").Block(lines...)
+	emitInitLaunchConfig(f, opts, preamble, startupDependencyTasks(depTasks, opts), Id("LaunchConfig").Values(withClosers(config, depTasks)))
 
-	emitRequireEnvVar(f)
+	emitInitOptions(f, t.App.Name != "")
+	emitClose(f)
+	emitFatal(f, opts)
+	emitDeployEnv(f)
+	emitWarnDeprecatedEnvVars(f, deprecated, opts)
+	emitDependencyStatus(f, startupDependencyTasks(depTasks, opts))
+	emitResource(f, t.App, kubernetesResourceAttributes)
+	emitDependencyHelpers(f, depTasks)
+	if opts.health {
+		emitCheckHealth(f, depTasks, opts)
+	}
+	if opts.lazy {
+		emitMustLaunchConfig(f)
+	}
+	emitRequireEnvVar(f, opts, envVarDefaults(t))
+	if opts.flags {
+		emitRegisterFlags(f, append(envVarNames(t), datastoreEnvVars(t.Datastores)...))
+	}
+	emitRequireDiscoveryEnvVars(f, discoveryReqs, opts)
+	emitCheckRequiredEnvVars(f, kubernetesSpec(t, opts.skipDependencies), opts)
+	if opts.dotenv {
+		emitLoadLocalEnvFile(f, opts)
+	}
+
+	if opts.spec {
+		emitLaunchSpec(f, kubernetesSpec(t, opts.skipDependencies), opts)
+	}
+	if opts.runtimeLimits {
+		if err := emitRuntimeLimits(f, t.Resources); err != nil {
+			return err
+		}
+	}
 
 	return f.Render(output)
 }
 
-func generateEnvironment(f *File, env []envVar, secrets []envVar) Dict {
-	optionalEnvVars := []string{
-		// Not used in dev
-		"TRACING_ACCESS_TOKEN",
-	}
-	envStruct := []Code{}
-	envInitDict := Dict{}
-	for _, v := range append(env, secrets...) {
-		envStruct = append(envStruct, List(Id(toPublicVar(v.Name))).String())
-		if contains(optionalEnvVars, v.Name) {
-			envInitDict[Id(toPublicVar(v.Name))] = Id("os.Getenv").Call(Lit(v.Name))
-		} else {
-			envInitDict[Id(toPublicVar(v.Name))] = Id("requireEnvVar").Call(Lit(v.Name))
+// kubernetesSpec lists the configuration declared in a values.yaml; secrets are always redacted
+func kubernetesSpec(t ValuesYML, skip map[string]bool) []specItem {
+	items := dependencySpecs(t.Dependencies, skip)
+	for _, v := range t.Env {
+		item := envVarSpec(v.Name, !contains(optionalEnvVars, v.Name), false)
+		item.defaultValue = v.Value
+		item.description = v.Description
+		item.deprecated = v.Deprecated
+		item.value = envFieldPath(v.Name, entryNames(t.EnvGroups))
+		items = append(items, item)
+	}
+	for _, v := range t.Secrets {
+		item := envVarSpec(v.Name, !contains(optionalEnvVars, v.Name), true)
+		item.description = v.Description
+		item.deprecated = v.Deprecated
+		item.value = envFieldPath(v.Name, entryNames(t.EnvGroups))
+		items = append(items, item)
+	}
+	for _, s := range t.ExternalUrlUsage {
+		items = append(items, externalURLSpec(s))
+	}
+	items = append(items, datastoreSpecs(t.Datastores)...)
+	return append(items, runtimeSpecs(t.Runtime)...)
+}
+
+// envEntries are a values.yaml's env vars, then its secrets
+func envEntries(t ValuesYML) []namedEntry {
+	entries := []namedEntry{}
+	for _, v := range append(append([]envVar{}, t.Env...), t.Secrets...) {
+		entries = append(entries, namedEntry{Name: v.Name, entryDocs: v.entryDocs})
+	}
+	return entries
+}
+
+// envVarDefaults are the env vars' non-empty values, which flag-aware lookups fall back to
+func envVarDefaults(t ValuesYML) map[string]string {
+	defaults := map[string]string{}
+	for _, v := range t.Env {
+		if v.Value != "" {
+			defaults[v.Name] = v.Value
 		}
 	}
-	f.Type().Id("Environment").Struct(envStruct...)
-	return envInitDict
+	return defaults
+}
+
+// envVarNames are the names of a values.yaml's env vars, then its secrets
+func envVarNames(t ValuesYML) []string {
+	return entryNames(envEntries(t))
 }
 
-func generateExternalUrlUsage(f *File, urls []string) Dict {
+func generateExternalUrlUsage(f *File, urls []namedEntry) Dict {
 	externalUrlStruct := []Code{}
 	externalUrlInitDict := Dict{}
-	for _, s := range urls {
-		externalUrlStruct = append(externalUrlStruct, List(Id(toPublicVar(s))).String())
-		externalUrlInitDict[Id(toPublicVar(s))] = Id("requireEnvVar").Call(Lit("EXTERNAL_URL_" + toEnvVarName(s)))
+	for _, e := range urls {
+		externalUrlStruct = append(externalUrlStruct, e.comments()...)
+		externalUrlStruct = append(externalUrlStruct, List(Id(toPublicVar(e.Name))).String())
+		externalUrlInitDict[Id(toPublicVar(e.Name))] = Id("requireEnvVar").Call(Lit("EXTERNAL_URL_" + toEnvVarName(e.Name)))
 	}
+	f.Comment("ExternalUrlUsage has the URLs of external services, read from EXTERNAL_URL_* env vars")
 	f.Type().Id("ExternalUrlUsage").Struct(externalUrlStruct...)
 	return externalUrlInitDict
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/dave/jennifer/jen"
+)
+
+// emitLazyDependencies writes a Dependencies struct whose clients are created on first use by
+// accessor methods, so binaries only need discovery env vars for the dependencies they call
+func emitLazyDependencies(f *jen.File, depTasks []initTask) jen.Dict {
+	usesOptions := needsInitOptions(depTasks)
+
+	f.Comment("Dependencies creates clients for the service's dependencies on first use")
+	f.Type().Id("Dependencies").Struct(
+		jen.Id("clients").Op("*").Id("dependencyClients"),
+	)
+
+	f.Comment("dependencyClients is shared by every copy of a Dependencies")
+	f.Type().Id("dependencyClients").StructFunc(func(g *jen.Group) {
+		if usesOptions {
+			g.Id("options").Id("initOptions")
+		}
+		for _, t := range depTasks {
+			g.Line()
+			g.Id(t.varName+"Once").Qual("sync", "Once")
+			g.Id(t.varName).Add(t.varType)
+			g.Id(t.varName + "Err").Error()
+		}
+	})
+
+	for _, t := range depTasks {
+		summary := []string{toPublicVar(t.name) + " returns the " + t.name + " client, creating it on first use"}
+		if t.optional {
+			summary = append(summary, "It's optional, and its error is the only sign it's unavailable: nothing is logged or recorded.")
+		}
+		for _, c := range t.docs.comments(summary...) {
+			f.Add(c)
+		}
+		f.Func().Params(jen.Id("d").Id("Dependencies")).Id(toPublicVar(t.name)).Params().Params(t.varType, jen.Error()).Block(
+			jen.Id("d").Dot("clients").Dot(t.varName+"Once").Dot("Do").Call(jen.Func().Params().BlockFunc(func(g *jen.Group) {
+				if t.usesOptions() {
+					g.Id("o").Op(":=").Id("d").Dot("clients").Dot("options")
+				}
+				g.List(jen.Id("c"), jen.Err()).Op(":=").Add(t.call)
+				g.If(jen.Err().Op("!=").Nil()).Block(
+					jen.Id("d").Dot("clients").Dot(t.varName+"Err").Op("=").Qual("fmt", "Errorf").Call(jen.Lit("discovery error for "+t.name+": %w"), jen.Err()),
+					jen.Return(),
+				)
+				g.Id("d").Dot("clients").Dot(t.varName).Op("=").Id("c")
+			})),
+			jen.Return(jen.Id("d").Dot("clients").Dot(t.varName), jen.Id("d").Dot("clients").Dot(t.varName+"Err")),
+		)
+	}
+
+	clients := jen.Dict{}
+	if usesOptions {
+		clients[jen.Id("options")] = jen.Id("o")
+	}
+	return jen.Dict{
+		jen.Id("clients"): jen.Op("&").Id("dependencyClients").Values(clients),
+	}
+}
+
+// startupDependencyTasks are the dependency clients InitLaunchConfig creates, rather than leaving to accessors
+func startupDependencyTasks(depTasks []initTask, opts options) []initTask {
+	if opts.lazy {
+		return []initTask{}
+	}
+	return depTasks
+}
+
+// emitMustLaunchConfig writes the process-wide LaunchConfig singleton
+func emitMustLaunchConfig(f *jen.File) {
+	f.Var().Defs(
+		jen.Id("launchConfigOnce").Qual("sync", "Once"),
+		jen.Id("launchConfig").Id("LaunchConfig"),
+	)
+
+	f.Comment("MustLaunchConfig returns the process-wide LaunchConfig, creating it with NewLaunchConfig(opts...) on first use.")
+	f.Comment("opts only apply to the first call, so pass them where the process starts, e.g. in main.")
+	f.Comment("Like NewLaunchConfig, it exits the program if a required env var is missing.")
+	f.Func().Id("MustLaunchConfig").Params(jen.Id("opts").Op("...").Id("Option")).Id("LaunchConfig").Block(
+		jen.Id("launchConfigOnce").Dot("Do").Call(jen.Func().Params().Block(
+			jen.Id("launchConfig").Op("=").Id("NewLaunchConfig").Call(jen.Id("opts").Op("...")),
+		)),
+		jen.Return(jen.Id("launchConfig")),
+	)
+}
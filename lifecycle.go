@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/dave/jennifer/jen"
+)
+
+// withClosers adds the config's closers to the LaunchConfig literal, if NewLaunchConfig resolves initOptions
+func withClosers(config jen.Dict, depTasks []initTask) jen.Dict {
+	if needsInitOptions(depTasks) {
+		config[jen.Id("closers")] = jen.Id("o").Dot("closers")
+	}
+	return config
+}
+
+// addCloser registers fn with o's closers
+func addCloser(fn jen.Code) jen.Code {
+	return jen.Id("o").Dot("closers").Dot("add").Call(fn)
+}
+
+// emitClose writes closers, and Close, which runs them
+func emitClose(f *jen.File) {
+	closeFunc := jen.Func().Params(jen.Qual("context", "Context")).Error()
+
+	f.Comment("closers shut down, in reverse order, the tracer provider and connections a LaunchConfig created")
+	f.Type().Id("closers").Struct(
+		jen.Id("mu").Qual("sync", "Mutex"),
+		jen.Id("closed").Bool(),
+		jen.Id("fns").Index().Add(closeFunc),
+	)
+
+	f.Comment("add registers fn to be run by close. If close has already run, such as after NewLaunchConfigContext")
+	f.Comment("timed out, fn is run right away.")
+	f.Func().Params(jen.Id("c").Op("*").Id("closers")).Id("add").Params(jen.Id("fn").Add(closeFunc)).Block(
+		jen.Id("c").Dot("mu").Dot("Lock").Call(),
+		jen.If(jen.Id("c").Dot("closed")).Block(
+			jen.Id("c").Dot("mu").Dot("Unlock").Call(),
+			jen.Id("_").Op("=").Id("fn").Call(jen.Qual("context", "Background").Call()),
+			jen.Return(),
+		),
+		jen.Id("c").Dot("fns").Op("=").Append(jen.Id("c").Dot("fns"), jen.Id("fn")),
+		jen.Id("c").Dot("mu").Dot("Unlock").Call(),
+	)
+
+	f.Comment("close runs every registered fn the first time it is called, and returns their errors joined")
+	f.Func().Params(jen.Id("c").Op("*").Id("closers")).Id("close").Params(jen.Id("ctx").Qual("context", "Context")).Error().Block(
+		jen.Id("c").Dot("mu").Dot("Lock").Call(),
+		jen.Defer().Id("c").Dot("mu").Dot("Unlock").Call(),
+		jen.If(jen.Id("c").Dot("closed")).Block(
+			jen.Return(jen.Nil()),
+		),
+		jen.Id("c").Dot("closed").Op("=").True(),
+		jen.Var().Id("errs").Index().Error(),
+		jen.For(jen.Id("i").Op(":=").Len(jen.Id("c").Dot("fns")).Op("-").Lit(1), jen.Id("i").Op(">=").Lit(0), jen.Id("i").Op("--")).Block(
+			jen.If(jen.Err().Op(":=").Id("c").Dot("fns").Index(jen.Id("i")).Call(jen.Id("ctx")), jen.Err().Op("!=").Nil()).Block(
+				jen.Id("errs").Op("=").Append(jen.Id("errs"), jen.Err()),
+			),
+		),
+		jen.Return(jen.Qual("errors", "Join").Call(jen.Id("errs").Op("..."))),
+	)
+
+	f.Comment("Close flushes and shuts down the tracer provider and connections the config created, and")
+	f.Comment("returns their errors joined. Calling it more than once is safe.")
+	f.Func().Params(jen.Id("c").Id("LaunchConfig")).Id("Close").Params(jen.Id("ctx").Qual("context", "Context")).Error().Block(
+		jen.If(jen.Id("c").Dot("closers").Op("==").Nil()).Block(
+			jen.Return(jen.Nil()),
+		),
+		jen.Return(jen.Id("c").Dot("closers").Dot("close").Call(jen.Id("ctx"))),
+	)
+}
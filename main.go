@@ -2,12 +2,21 @@ package main
 
 import (
 	"flag"
+	"go/token"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "preflight" {
+		if err := runPreflight(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	packageName := flag.String("p", "main", "optional package name")
 	outputFile := flag.String("o", "", "optional output to file. Default is stdout")
 	skipDependencies := map[string]bool{}
@@ -15,12 +24,39 @@ func main() {
 		skipDependencies[s] = true
 		return nil
 	})
+	overrides := []string{}
+	flag.Func("override", "Override how a dependency's client is imported and created, in the format dep:key=value,... with keys import, suffix, constructor and tracingName. Can be added multiple times", func(s string) error {
+		overrides = append(overrides, s)
+		return nil
+	})
 	overrideDependenciesString := flag.String("d", "", "Dependency name to override. You can provide multiple dependencies in the format dep1:replacementDep1,dep2:replacementDep2,...")
 	kubernetes := flag.Bool("kubernetes", false, "generate from a clever-application values.yaml (Kubernetes) instead of launch.yml (Fargate)")
+	spec := flag.Bool("spec", false, "also generate LaunchSpec, DebugHandler and LogSummary for runtime introspection")
+	dotenv := flag.Bool("dotenv", false, "make InitLaunchConfig load .env.local when DEPLOY_ENV is \"local\"")
+	flags := flag.Bool("flags", false, "also generate RegisterFlags, so env vars can be overridden with command-line flags")
+	contextInit := flag.Bool("context", false, "also generate NewLaunchConfigContext, which creates dependencies concurrently under a timeout")
+	initTimeout := flag.Duration("init-timeout", defaultInitTimeout, "default InitTimeout for -context")
+	lazy := flag.Bool("lazy", false, "create dependency clients on first use through Dependencies accessor methods, and generate MustLaunchConfig")
+	clientconfigImport := flag.String("clientconfig-import", defaultClientconfigImport, "import path of the package that configures wag clients")
+	clientconfigFunc := flag.String("clientconfig-func", defaultClientconfigFunc, "function in -clientconfig-import that takes a dependency name, and returns NewFromDiscovery's arguments: an untraced *http.Client and a logger")
+	health := flag.Bool("health", false, "also generate CheckHealth and HealthHandler, which check every dependency for readiness probes")
+	runtimeLimits := flag.Bool("runtime-limits", false, "with -kubernetes, also generate the container's CPU and memory from resources, and ApplyRuntimeLimits, which sets GOMAXPROCS and GOMEMLIMIT from them")
+	logFormat := flag.String("log-format", "", "route errors that exit the program through a generated, replaceable FatalLogger that writes \"text\" or \"kayvee\" JSON lines. By default, generated code calls log.Fatalf")
+	envExample := flag.String("env-example", "", "optional file to write an example env file to, e.g. .env.example")
 	flag.Parse()
 
 	if len(flag.Args()) < 1 {
-		log.Fatal("usage: launch-gen [-p <package_name>] <file>")
+		log.Fatal("usage: launch-gen [-p <package_name>] <file>\n       launch-gen preflight [-kubernetes] [-env-file <file>] <file>")
+	}
+
+	if err := validateLogFormat(*logFormat); err != nil {
+		log.Fatal(err)
+	}
+	if *runtimeLimits && !*kubernetes {
+		log.Fatal("-runtime-limits requires -kubernetes")
+	}
+	if !token.IsIdentifier(*clientconfigFunc) {
+		log.Fatalf("-clientconfig-func %q is not a Go identifier", *clientconfigFunc)
 	}
 
 	output := os.Stdout
@@ -42,7 +78,39 @@ func main() {
 	if *kubernetes {
 		gen = generateKubernetes
 	}
-	if err := gen(*packageName, skipDependencies, *overrideDependenciesString, data, output); err != nil {
+	opts := options{
+		packageName:          *packageName,
+		skipDependencies:     skipDependencies,
+		overrideDependencies: *overrideDependenciesString,
+		overrides:            overrides,
+		spec:                 *spec,
+		dotenv:               *dotenv,
+		flags:                *flags,
+		context:              *contextInit,
+		initTimeout:          *initTimeout,
+		lazy:                 *lazy,
+		clientconfigImport:   *clientconfigImport,
+		clientconfigFunc:     *clientconfigFunc,
+		logFormat:            *logFormat,
+		health:               *health,
+		runtimeLimits:        *runtimeLimits,
+	}
+	if err := gen(opts, data, output); err != nil {
 		log.Fatal(err)
 	}
+
+	if *envExample != "" {
+		items, err := parseSpec(*kubernetes, data, skipDependencies)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f, err := os.Create(*envExample)
+		if err != nil {
+			log.Fatalf("error opening file '%s': %s", *envExample, err)
+		}
+		defer f.Close()
+		if err := writeEnvExample(f, filepath.Base(flag.Args()[0]), items); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
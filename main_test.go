@@ -1,10 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dave/jennifer/jen"
+	"github.com/go-yaml/yaml"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -121,11 +126,14 @@ func Test_toEnvVarName(t *testing.T) {
 func Test_getS3NameByEnv(t *testing.T) {
 	// taken from generated fixtures
 	var podAccountSuffixMap = map[string]bool{"585008086734": true}
-	testS3NameByEnv := func(s string) string {
-		env := os.Getenv("DEPLOY_ENV")
-		if env == "" {
-			env = os.Getenv("_DEPLOY_ENV")
+	currentDeployEnv := func() string {
+		if env := os.Getenv("DEPLOY_ENV"); env != "" {
+			return env
 		}
+		return os.Getenv("_DEPLOY_ENV")
+	}
+	testS3NameByEnv := func(s string) string {
+		env := currentDeployEnv()
 		if env == "" {
 			log.Fatal("Unable to determine deployment environment (DEPLOY_ENV and _DEPLOY_ENV are undefined)")
 		}
@@ -253,3 +261,636 @@ func Test_getS3NameByEnv(t *testing.T) {
 		})
 	}
 }
+
+func Test_dependencyUnmarshalYAML(t *testing.T) {
+	var deps []dependency
+	err := yaml.Unmarshal([]byte("- workflow-manager\n- name: dapple\n  optional: true\n"), &deps)
+	assert.NoError(t, err)
+	assert.Equal(t, []dependency{{Name: "workflow-manager"}, {Name: "dapple", Optional: true}}, deps)
+
+	err = yaml.Unmarshal([]byte("- optional: true\n"), &deps)
+	assert.EqualError(t, err, "dependency is missing a name")
+
+	err = yaml.Unmarshal([]byte("- name: legacy-api\n  kind: soap\n"), &deps)
+	assert.EqualError(t, err, `dependency legacy-api: invalid kind "soap", must be one of: wag, http, grpc`)
+
+	err = yaml.Unmarshal([]byte("- name: legacy-api\n  kind: http\n  timeout: 5s\n"), &deps)
+	assert.EqualError(t, err, "dependency legacy-api: version, timeout, retries and circuitBreaker are only supported for wag dependencies")
+}
+
+func Test_clientImportAlias(t *testing.T) {
+	assert.Equal(t, "workflowmanagerclient", clientImportAlias("workflow-manager"))
+	assert.Equal(t, "dappleclient", clientImportAlias("dapple"))
+	assert.Equal(t, "legacyapiclient", clientImportAlias("legacy-api"))
+}
+
+func Test_clientImportPath(t *testing.T) {
+	tests := []struct {
+		input    dependency
+		expected string
+	}{
+		{input: dependency{Name: "dapple"}, expected: "github.com/Clever/dapple/gen-go/client"},
+		{input: dependency{Name: "dapple", Version: 1}, expected: "github.com/Clever/dapple/gen-go/client"},
+		{input: dependency{Name: "dapple", Version: 5}, expected: "github.com/Clever/dapple/gen-go/client/v5"},
+		{input: dependency{Name: "workflow-manager", Version: 2}, expected: "github.com/Clever/wfm/gen-go/client"},
+		{input: dependency{Name: "rostering", Version: 2}, expected: "github.com/Clever/rostering/client/v2"},
+	}
+	overrides := map[string]dependencyOverride{
+		"workflow-manager": {importPath: "github.com/Clever/wfm/gen-go/client"},
+		"rostering":        {suffix: "/client"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, clientImportPath(tt.input, overrides))
+	}
+}
+
+func Test_parseOverride(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedDep string
+		expected    dependencyOverride
+		expectedErr string
+	}{
+		{
+			input:       "dapple:import=github.com/Clever/dapple/gen-go/client/v5,constructor=New,tracingName=dapple-v5",
+			expectedDep: "dapple",
+			expected:    dependencyOverride{importPath: "github.com/Clever/dapple/gen-go/client/v5", constructor: "New", tracingName: "dapple-v5"},
+		},
+		{input: "dapple:suffix=/client", expectedDep: "dapple", expected: dependencyOverride{suffix: "/client"}},
+		{input: "dapple", expectedErr: `invalid -override "dapple", expected dep:key=value,...`},
+		{input: "dapple:import", expectedErr: `invalid -override "dapple:import": "import" is not key=value`},
+		{input: "dapple:version=5", expectedErr: `invalid -override "dapple:version=5": unknown key "version", must be one of: import, suffix, constructor, tracingName`},
+		{input: "dapple:constructor=New-Client", expectedErr: `invalid -override "dapple:constructor=New-Client": constructor "New-Client" is not a Go identifier`},
+		{input: "dapple:import=a/b,suffix=/c", expectedErr: `invalid -override "dapple:import=a/b,suffix=/c": import and suffix can't both be set`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			dep, o, err := parseOverride(tt.input)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedDep, dep)
+			assert.Equal(t, tt.expected, o)
+		})
+	}
+}
+
+func Test_parseOverrides(t *testing.T) {
+	deps := []dependency{{Name: "dapple"}, {Name: "workflow-manager"}, {Name: "legacy-api", Kind: dependencyKindHTTP}, {Name: "rostering", Version: 3}}
+
+	overrides, err := parseOverrides(options{overrideDependencies: "dapple:dapple/gen-go/client/v5", overrides: []string{"workflow-manager:tracingName=wfm"}}, deps)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]dependencyOverride{
+		"dapple":           {importPath: "github.com/Clever/dapple/gen-go/client/v5"},
+		"workflow-manager": {tracingName: "wfm"},
+	}, overrides)
+
+	_, err = parseOverrides(options{overrideDependencies: "dapple"}, deps)
+	assert.EqualError(t, err, `invalid formatting for the -d flag: "dapple"`)
+
+	_, err = parseOverrides(options{overrides: []string{"search:tracingName=api"}}, deps)
+	assert.EqualError(t, err, "search is not a dependency specified in the provided yaml file")
+
+	_, err = parseOverrides(options{overrides: []string{"legacy-api:tracingName=api"}}, deps)
+	assert.EqualError(t, err, "legacy-api has kind http, but only wag dependencies can be overridden")
+
+	_, err = parseOverrides(options{overrideDependencies: "legacy-api:legacy/gen-go/client"}, deps)
+	assert.EqualError(t, err, "legacy-api has kind http, but only wag dependencies can be overridden")
+
+	overrides, err = parseOverrides(options{overrides: []string{"rostering:import=github.com/Clever/rostering-v2/gen-go/client"}}, deps)
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com/Clever/rostering-v2/gen-go/client/v3", overrides["rostering"].importPath)
+
+	overrides, err = parseOverrides(options{overrideDependencies: "rostering:rostering-v2/gen-go/client/v3"}, deps)
+	assert.NoError(t, err)
+	assert.Equal(t, "github.com/Clever/rostering-v2/gen-go/client/v3", overrides["rostering"].importPath)
+
+	_, err = parseOverrides(options{overrides: []string{"rostering:import=github.com/Clever/rostering/gen-go/client/v2"}}, deps)
+	assert.EqualError(t, err, "rostering is version 3, but its import is overridden with github.com/Clever/rostering/gen-go/client/v2")
+
+	_, err = parseOverrides(options{overrideDependencies: "dapple:dapple/gen-go/client/v5", overrides: []string{"dapple:tracingName=d"}}, deps)
+	assert.EqualError(t, err, "dapple is overridden more than once")
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func Test_clientSettingsKeepsZero(t *testing.T) {
+	d := dependency{Name: "dapple", CircuitBreaker: &circuitBreaker{ErrorPercentThreshold: intPtr(0)}}
+	settings := clientSettings(d, "github.com/Clever/dapple/gen-go/client")
+	assert.Len(t, settings, 1)
+	rendered := fmt.Sprintf("%#v", jen.Id("c").Add(settings[0]))
+	assert.Contains(t, rendered, "ErrorPercentThreshold:  0,")
+	assert.Contains(t, rendered, "SleepWindow:            5000,")
+}
+
+func Test_validateClientSettings(t *testing.T) {
+	tests := []struct {
+		input    dependency
+		expected string
+	}{
+		{input: dependency{Name: "dapple"}},
+		{input: dependency{Name: "dapple", Timeout: "5s", Retries: "single", CircuitBreaker: &circuitBreaker{ErrorPercentThreshold: intPtr(50)}}},
+		{input: dependency{Name: "dapple", Timeout: "5"}, expected: `dependency dapple: invalid timeout: time: missing unit in duration "5"`},
+		{input: dependency{Name: "dapple", Timeout: "-1s"}, expected: "dependency dapple: timeout must be positive"},
+		{input: dependency{Name: "dapple", Retries: "3"}, expected: `dependency dapple: invalid retries "3", must be one of: exponential, none, single`},
+		{input: dependency{Name: "dapple", CircuitBreaker: &circuitBreaker{SleepWindow: intPtr(-1)}}, expected: "dependency dapple: circuitBreaker values must not be negative"},
+		{input: dependency{Name: "dapple", CircuitBreaker: &circuitBreaker{ErrorPercentThreshold: intPtr(101)}}, expected: "dependency dapple: circuitBreaker errorPercentThreshold must be between 0 and 100"},
+	}
+	for _, tt := range tests {
+		err := validateClientSettings(tt.input)
+		if tt.expected == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.expected)
+		}
+	}
+}
+
+func Test_looksSecret(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{
+			name:     "token",
+			input:    "TRACING_ACCESS_TOKEN",
+			expected: true,
+		},
+		{
+			name:     "password",
+			input:    "DB_PASSWORD",
+			expected: true,
+		},
+		{
+			name:     "api key",
+			input:    "STRIPE_API_KEY",
+			expected: true,
+		},
+		{
+			name:     "plain env var",
+			input:    "ENV_VAR_A",
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := looksSecret(tt.input)
+			assert.Equal(t, tt.expected, actual, tt.name)
+		})
+	}
+}
+
+func Test_parseEnvFile(t *testing.T) {
+	input := `# comment
+ENV_VAR_A=a
+
+export ENV_VAR_B="quoted value"
+EMPTY=
+WITH_EQUALS=a=b
+`
+	actual, err := parseEnvFile(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"ENV_VAR_A":   "a",
+		"ENV_VAR_B":   "quoted value",
+		"EMPTY":       "",
+		"WITH_EQUALS": "a=b",
+	}, actual)
+
+	_, err = parseEnvFile(strings.NewReader("NOT_AN_ASSIGNMENT"))
+	assert.Error(t, err)
+}
+
+func Test_checkRequirements(t *testing.T) {
+	items := fargateSpec(LaunchYML{
+		Env:          []namedEntry{{Name: "ENV_VAR_A"}, {Name: "TRACING_ACCESS_TOKEN"}},
+		Dependencies: []dependency{{Name: "dapple"}},
+	}, nil)
+	items = append(items, s3BucketSpec("bucket", true, false, entryDocs{}))
+	env := map[string]string{
+		"ENV_VAR_A":                    "a",
+		"SERVICE_DAPPLE_DEFAULT_PROTO": "http",
+		"SERVICE_DAPPLE_DEFAULT_HOST":  "localhost",
+		"_DEPLOY_ENV":                  "development",
+	}
+	results := checkRequirements(requirements(items, false), func(s string) (string, bool) {
+		v, ok := env[s]
+		return v, ok
+	})
+
+	statuses := map[string]string{}
+	for _, r := range results {
+		statuses[r.name] = r.status()
+	}
+	assert.Equal(t, map[string]string{
+		"dapple":               "MISSING",
+		"ENV_VAR_A":            "ok",
+		"TRACING_ACCESS_TOKEN": "unset",
+		"deploy environment":   "ok",
+	}, statuses)
+	assert.Equal(t, []string{"SERVICE_DAPPLE_DEFAULT_PORT"}, results[0].missing)
+}
+
+func Test_missingDiscoveryMessage(t *testing.T) {
+	items := fargateSpec(LaunchYML{
+		Dependencies:     []dependency{{Name: "workflow-manager"}, {Name: "dapple"}},
+		ExternalUrlUsage: []namedEntry{{Name: "clever.com"}},
+	}, nil)
+	env := map[string]string{
+		"SERVICE_WORKFLOW_MANAGER_HTTP_PROTO": "http",
+		"SERVICE_WORKFLOW_MANAGER_HTTP_HOST":  "localhost",
+		"SERVICE_WORKFLOW_MANAGER_HTTP_PORT":  "80",
+		"SERVICE_DAPPLE_DEFAULT_HOST":         "localhost",
+	}
+	results := checkRequirements(discoveryRequirements(items), func(s string) (string, bool) {
+		v, ok := env[s]
+		return v, ok
+	})
+	assert.Equal(t,
+		"missing discovery env vars: dapple (SERVICE_DAPPLE_DEFAULT_PROTO, SERVICE_DAPPLE_DEFAULT_PORT); clever.com (EXTERNAL_URL_CLEVER_COM)",
+		missingDiscoveryMessage(results))
+}
+
+func Test_writeEnvExample(t *testing.T) {
+	items := kubernetesSpec(ValuesYML{
+		Env: []envVar{
+			{Name: "ENV_VAR_A", Value: "has \"quotes\" # and a hash"},
+			{Name: "TRACING_ACCESS_TOKEN"},
+		},
+	}, nil)
+	var b strings.Builder
+	assert.NoError(t, writeEnvExample(&b, "values.yaml", items))
+	assert.Contains(t, b.String(), "\n# TRACING_ACCESS_TOKEN (optional)\n# TRACING_ACCESS_TOKEN=\n")
+
+	// the example must read back with the defaults intact
+	env, err := parseEnvFile(strings.NewReader(b.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ENV_VAR_A": `has "quotes" # and a hash`}, env)
+}
+
+func Test_toFlagName(t *testing.T) {
+	assert.Equal(t, "env-var-a", toFlagName("ENV_VAR_A"))
+	assert.Equal(t, "port", toFlagName("PORT"))
+}
+
+func Test_envVarDefaults(t *testing.T) {
+	values := ValuesYML{
+		Env: []envVar{
+			{Name: "ENV_VAR_A", Value: "default value"},
+			{Name: "ENV_VAR_B", Value: ""},
+		},
+		Secrets: []envVar{{Name: "SECRET_VAR"}},
+	}
+	assert.Equal(t, map[string]string{"ENV_VAR_A": "default value"}, envVarDefaults(values))
+}
+
+func Test_s3BucketDocs(t *testing.T) {
+	var launch LaunchYML
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+aws:
+  s3:
+    read:
+      - name: reports
+        description: Uploaded reports
+    write:
+      - name: reports
+        deprecated: use exports
+      - scratch
+`), &launch))
+	assert.Equal(t, entryDocs{Description: "Uploaded reports", Deprecated: "use exports"}, s3BucketDocs(launch, "reports"))
+	assert.Equal(t, entryDocs{}, s3BucketDocs(launch, "scratch"))
+	assert.Equal(t, []string{"reports", "scratch"}, s3BucketNames(launch))
+}
+
+func Test_requiredEnvVars(t *testing.T) {
+	items := fargateSpec(LaunchYML{
+		Env:              []namedEntry{{Name: "ENV_VAR_A"}, {Name: "TRACING_ACCESS_TOKEN"}},
+		ExternalUrlUsage: []namedEntry{{Name: "clever.com"}},
+		Datastores:       []datastore{{Name: "cache", Kind: "redis"}},
+	}, nil)
+	assert.Equal(t, []string{"ENV_VAR_A", "CACHE_HOST"}, requiredEnvVars(items))
+	assert.False(t, hasS3Buckets(items))
+}
+
+func Test_durationExpr(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{input: 30 * time.Second, expected: "30 * time.Second"},
+		{input: 90 * time.Second, expected: "90 * time.Second"},
+		{input: 2 * time.Hour, expected: "2 * time.Hour"},
+		{input: 1500 * time.Millisecond, expected: "1500 * time.Millisecond"},
+		{input: 10, expected: "10 * time.Nanosecond"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input.String(), func(t *testing.T) {
+			actual := fmt.Sprintf("%#v", durationExpr(tt.input))
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_startupDiscoveryRequirements(t *testing.T) {
+	items := fargateSpec(LaunchYML{
+		Dependencies:     []dependency{{Name: "dapple"}, {Name: "workflow-manager", Optional: true}},
+		ExternalUrlUsage: []namedEntry{{Name: "clever.com"}},
+	}, nil)
+
+	names := func(reqs []requirement) []string {
+		out := []string{}
+		for _, r := range reqs {
+			out = append(out, r.name)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"dapple", "clever.com"}, names(startupDiscoveryRequirements(items, options{})))
+	assert.Equal(t, []string{"clever.com"}, names(startupDiscoveryRequirements(items, options{lazy: true})))
+}
+
+func Test_validateLogFormat(t *testing.T) {
+	for _, format := range []string{"", "text", "kayvee"} {
+		assert.NoError(t, validateLogFormat(format), format)
+	}
+	assert.EqualError(t, validateLogFormat("json"), `invalid -log-format "json", must be text or kayvee`)
+}
+
+func Test_healthCheckFunc(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     initTask
+		opts     options
+		expected string
+	}{
+		{
+			name:     "wag",
+			task:     initTask{name: "dapple", kind: dependencyKindWag},
+			expected: "func(ctx context.Context) error {\n\treturn d.Dapple.HealthCheck(ctx)\n}",
+		},
+		{
+			name:     "optional http",
+			task:     initTask{name: "legacy-api", kind: dependencyKindHTTP, optional: true},
+			expected: "func(ctx context.Context) error {\n\tif d.LegacyAPI == nil {\n\t\treturn errors.New(\"optional dependency legacy-api is unavailable\")\n\t}\n\treturn probeURL(ctx, d.LegacyAPI)\n}",
+		},
+		{
+			name:     "lazy grpc",
+			task:     initTask{name: "rostering", kind: dependencyKindGRPC},
+			opts:     options{lazy: true},
+			expected: "func(ctx context.Context) error {\n\tc, err := d.Rostering()\n\tif err != nil {\n\t\treturn err\n\t}\n\treturn probeTCP(ctx, c.Target())\n}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, "var check = "+tt.expected, fmt.Sprintf("%#v", jen.Var().Id("check").Op("=").Add(healthCheckFunc(tt.task, tt.opts))))
+		})
+	}
+}
+
+func Test_parseQuantity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{input: "100m", expected: "1/10"},
+		{input: "1.5", expected: "3/2"},
+		{input: "2", expected: "2"},
+		{input: "512Mi", expected: "536870912"},
+		{input: "1.5Gi", expected: "1610612736"},
+		{input: "1G", expected: "1000000000"},
+		{input: "1E", expected: "1000000000000000000"},
+		{input: "1e3", expected: "1000"},
+		{input: "25E-2", expected: "1/4"},
+		{input: "+1k", expected: "1000"},
+		{input: "-1", err: `invalid quantity "-1"`},
+		{input: "1.2.3", err: `invalid quantity "1.2.3"`},
+		{input: "1Gb", err: `invalid quantity "1Gb": unknown suffix "Gb"`},
+		{input: "1ex", err: `invalid quantity "1ex": bad exponent`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			actual, err := parseQuantity(tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual.RatString())
+		})
+	}
+}
+
+func Test_runtimeLimits(t *testing.T) {
+	cpu, memory, err := runtimeLimits(containerResources{
+		Requests: resourceList{CPU: "100m", Memory: "256Mi"},
+		Limits:   resourceList{Memory: "1.5Gi"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), cpu)
+	assert.Equal(t, int64(1610612736), memory)
+
+	cpu, memory, err = runtimeLimits(containerResources{Limits: resourceList{CPU: "0.0001"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), cpu, "rounds up to a millicore")
+	assert.Equal(t, int64(0), memory)
+
+	_, _, err = runtimeLimits(containerResources{Limits: resourceList{Memory: "lots"}})
+	assert.EqualError(t, err, `resources memory: invalid quantity "lots"`)
+}
+
+func Test_runtimeSectionUnmarshalYAML(t *testing.T) {
+	var absent ValuesYML
+	assert.NoError(t, yaml.Unmarshal([]byte("env: []"), &absent))
+	assert.Nil(t, absent.Runtime)
+
+	var values ValuesYML
+	assert.NoError(t, yaml.Unmarshal([]byte("runtime: [podIP, podName]"), &values))
+	assert.Equal(t, runtimeSection{runtimeFields[3], runtimeFields[0]}, values.Runtime)
+
+	assert.NoError(t, yaml.Unmarshal([]byte("runtime: [{name: nodeName, deprecated: use podName}]"), &values))
+	nodeName := runtimeFields[2]
+	nodeName.Deprecated = "use podName"
+	assert.Equal(t, runtimeSection{nodeName}, values.Runtime)
+	assert.Empty(t, deprecatedEnvVars(runtimeSpecs(values.Runtime)))
+
+	err := yaml.Unmarshal([]byte("runtime: [hostname]"), &values)
+	assert.EqualError(t, err, `unknown runtime field "hostname", must be one of podName, namespace, nodeName, podIP`)
+}
+
+func Test_validateExposedPorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []exposedPort
+		err   string
+	}{
+		{name: "valid", ports: []exposedPort{{Name: "default", Port: 80}, {Name: "metrics", ContainerPort: 9090}}},
+		{name: "none"},
+		{name: "no name", ports: []exposedPort{{Port: 80}}, err: "exposed port 80 has no name"},
+		{name: "duplicate name", ports: []exposedPort{{Name: "http", Port: 80}, {Name: "http", Port: 81}}, err: `exposed port "http" is declared more than once`},
+		{name: "duplicate field name", ports: []exposedPort{{Name: "grpc-api", Port: 80}, {Name: "grpc_api", Port: 81}}, err: `exposed port "grpc_api" is declared more than once`},
+		{name: "duplicate number", ports: []exposedPort{{Name: "http", Port: 80}, {Name: "default", Port: 80}}, err: `exposed ports "http" and "default" are both 80`},
+		{name: "zero", ports: []exposedPort{{Name: "http"}}, err: `exposed port "http" is 0, must be between 1 and 65535`},
+		{name: "too large", ports: []exposedPort{{Name: "http", Port: 65536}}, err: `exposed port "http" is 65536, must be between 1 and 65535`},
+		{name: "conflicting", ports: []exposedPort{{Name: "http", Port: 80, ContainerPort: 8080}}, err: `exposed port "http" has both port 80 and containerPort 8080`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateExposedPorts(tt.ports)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func Test_validateDatastores(t *testing.T) {
+	tests := []struct {
+		name       string
+		datastores []datastore
+		err        string
+	}{
+		{name: "valid", datastores: []datastore{{Name: "main-db", Kind: "postgres"}, {Name: "cache", Kind: "redis", Prefix: "SESSION_REDIS"}}},
+		{name: "no name", datastores: []datastore{{Kind: "redis"}}, err: "datastore has no name"},
+		{name: "unknown kind", datastores: []datastore{{Name: "db", Kind: "mysql"}}, err: `datastore "db" has unknown kind "mysql", must be one of [mongodb postgres redis]`},
+		{name: "duplicate name", datastores: []datastore{{Name: "db", Kind: "postgres"}, {Name: "db", Kind: "redis", Prefix: "CACHE"}}, err: `datastore "db" is declared more than once`},
+		{name: "duplicate prefix", datastores: []datastore{{Name: "main-db", Kind: "postgres"}, {Name: "cache", Kind: "redis", Prefix: "MAIN_DB"}}, err: `datastores "main-db" and "cache" both use the env var prefix MAIN_DB`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDatastores(tt.datastores)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func Test_envGroup(t *testing.T) {
+	groups := []string{"REDIS", "REDIS_CACHE"}
+	assert.Equal(t, "REDIS", envGroup("REDIS_HOST", groups))
+	assert.Equal(t, "REDIS_CACHE", envGroup("REDIS_CACHE_HOST", groups), "longest prefix wins")
+	assert.Equal(t, "", envGroup("REDIS", groups), "the prefix alone isn't in the group")
+	assert.Equal(t, "", envGroup("REDISHOST", groups))
+	assert.Equal(t, "Host", envField("REDIS_CACHE_HOST", "REDIS_CACHE"))
+	assert.Equal(t, `c.Env.Redis.Host`, fmt.Sprintf("%#v", envFieldPath("REDIS_HOST", groups)))
+}
+
+func Test_validateEnvGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		names  []string
+		groups []string
+		err    string
+	}{
+		{name: "valid", names: []string{"REDIS_HOST", "REDIS_PORT", "PORT"}, groups: []string{"REDIS"}},
+		{name: "no groups", names: []string{"REDIS_HOST"}},
+		{name: "trailing underscore", names: []string{"REDIS_HOST"}, groups: []string{"REDIS_"}, err: `env group "REDIS_" must be a prefix without a trailing _, e.g. REDIS`},
+		{name: "duplicate", names: []string{"REDIS_HOST"}, groups: []string{"REDIS", "REDIS"}, err: `env group "REDIS" is declared more than once`},
+		{name: "unused", names: []string{"PORT"}, groups: []string{"REDIS"}, err: `env group "REDIS" has no env vars`},
+		{name: "var named like group", names: []string{"REDIS", "REDIS_HOST"}, groups: []string{"REDIS"}, err: "env var REDIS and group REDIS would both be the field Redis"},
+		{name: "fields collide", names: []string{"REDIS_HOST", "REDIS__HOST"}, groups: []string{"REDIS"}, err: "env var REDIS_HOST and var REDIS__HOST would both be the field Host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnvGroups(tt.names, tt.groups)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func Test_namedEntryUnmarshalYAML(t *testing.T) {
+	var launch LaunchYML
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+env:
+  - ENV_VAR_A
+  - name: ENV_VAR_B
+    description: the B
+    deprecated: use ENV_VAR_A
+dependencies:
+  - name: dapple
+    deprecated: gone
+`), &launch))
+	assert.Equal(t, []namedEntry{
+		{Name: "ENV_VAR_A"},
+		{Name: "ENV_VAR_B", entryDocs: entryDocs{Description: "the B", Deprecated: "use ENV_VAR_A"}},
+	}, launch.Env)
+	assert.Equal(t, "gone", launch.Dependencies[0].Deprecated)
+
+	err := yaml.Unmarshal([]byte("env: [{description: nameless}]"), &launch)
+	assert.EqualError(t, err, "entry is missing a name")
+}
+
+func Test_entryDocsComments(t *testing.T) {
+	render := func(codes []jen.Code) string {
+		return fmt.Sprintf("%#v", jen.Type().Id("T").Struct(append(codes, jen.Id("F").String())...))
+	}
+	assert.Equal(t, "type T struct {\n\tF string\n}", render(entryDocs{}.comments()))
+	assert.Equal(t, "type T struct {\n\t// the F\n\tF string\n}", render(entryDocs{Description: "the F"}.comments()))
+	assert.Equal(t, "type T struct {\n\t// Deprecated: use G\n\tF string\n}", render(entryDocs{Deprecated: "use G"}.comments()))
+	assert.Equal(t, "type T struct {\n\t// F is f\n\t//\n\t// the F\n\t//\n\t// Deprecated: use G\n\tF string\n}",
+		render(entryDocs{Description: "the F", Deprecated: "use G"}.comments("F is f")))
+}
+
+func Test_deprecatedEnvVars(t *testing.T) {
+	items := kubernetesSpec(ValuesYML{
+		Env:              []envVar{{Name: "ENV_VAR_A"}, {Name: "ENV_VAR_B", entryDocs: entryDocs{Deprecated: "use ENV_VAR_A"}}},
+		Dependencies:     []dependency{{Name: "dapple", entryDocs: entryDocs{Deprecated: "gone"}}},
+		ExternalUrlUsage: []namedEntry{{Name: "clever.com", entryDocs: entryDocs{Deprecated: "unused"}}},
+	}, nil)
+	assert.Equal(t, []deprecatedEnvVar{
+		{envVar: "ENV_VAR_B", reason: "use ENV_VAR_A"},
+		{envVar: "EXTERNAL_URL_CLEVER_COM", reason: "unused"},
+	}, deprecatedEnvVars(items))
+}
+
+func Test_requirementsDeployEnv(t *testing.T) {
+	lookup := func(env map[string]string) func(string) (string, bool) {
+		return func(s string) (string, bool) {
+			v, ok := env[s]
+			return v, ok
+		}
+	}
+	buckets := []specItem{s3BucketSpec("bucket", true, false, entryDocs{})}
+
+	results := checkRequirements(requirements(buckets, false), lookup(map[string]string{"DEPLOY_ENV": ""}))
+	assert.Equal(t, "MISSING", results[0].status())
+	assert.Equal(t, []string{"DEPLOY_ENV (empty)"}, results[0].missing)
+
+	results = checkRequirements(requirements(buckets, false), lookup(map[string]string{"DEPLOY_ENV": "", "_DEPLOY_ENV": "production"}))
+	assert.Equal(t, "ok", results[0].status())
+
+	assert.Empty(t, requirements(nil, false))
+	results = checkRequirements(requirements(nil, true), lookup(map[string]string{}))
+	assert.Equal(t, "deploy environment", results[0].name)
+	assert.Equal(t, "MISSING", results[0].status())
+}
+
+func Test_requirementsDefault(t *testing.T) {
+	items := kubernetesSpec(ValuesYML{
+		Env: []envVar{{Name: "LOG_LEVEL", Value: "info"}, {Name: "ENV_VAR_A"}},
+	}, nil)
+	results := checkRequirements(requirements(items, true), func(s string) (string, bool) {
+		return "", false
+	})
+
+	statuses := map[string]string{}
+	for _, r := range results {
+		statuses[r.name] = r.status()
+	}
+	assert.Equal(t, "default", statuses["LOG_LEVEL"])
+	assert.Equal(t, "MISSING", statuses["ENV_VAR_A"])
+	assert.Equal(t, []string{"ENV_VAR_A"}, requiredEnvVars(items))
+}
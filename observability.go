@@ -0,0 +1,226 @@
+package main
+
+import (
+	"github.com/dave/jennifer/jen"
+)
+
+const (
+	sdkTracePath = "go.opentelemetry.io/otel/sdk/trace"
+	otelhttpPath = "go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	otelgrpcPath = "go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	// wagClientLoggerPath defines the logger wag clients take
+	wagClientLoggerPath = "github.com/Clever/wag/logging/wagclientlogger"
+)
+
+// initOption is a generated With* option, and the initOptions field it sets
+type initOption struct {
+	name        string
+	param       string
+	field       string
+	fieldType   jen.Code
+	description string
+}
+
+var initOptionSpecs = []initOption{
+	{
+		name:        "WithSpanExporter",
+		param:       "exp",
+		field:       "exporter",
+		fieldType:   jen.Qual(sdkTracePath, "SpanExporter"),
+		description: "WithSpanExporter traces dependency clients to exp. By default, spans are dropped. Close flushes spans to exp, but shutting it down is left to the caller.",
+	},
+	{
+		name:        "WithTracerProvider",
+		param:       "tp",
+		field:       "tracerProvider",
+		fieldType:   jen.Qual("go.opentelemetry.io/otel/trace", "TracerProvider"),
+		description: "WithTracerProvider traces dependency clients with tp, instead of a tracer provider that exports to the WithSpanExporter exporter",
+	},
+	{
+		name:        "WithMeterProvider",
+		param:       "mp",
+		field:       "meterProvider",
+		fieldType:   jen.Qual("go.opentelemetry.io/otel/metric", "MeterProvider"),
+		description: "WithMeterProvider records dependency client metrics with mp",
+	},
+	{
+		name:        "WithPropagators",
+		param:       "p",
+		field:       "propagators",
+		fieldType:   jen.Qual("go.opentelemetry.io/otel/propagation", "TextMapPropagator"),
+		description: "WithPropagators propagates trace context from dependency clients with p, rather than the global propagators",
+	},
+	{
+		name:        "WithLogger",
+		param:       "l",
+		field:       "logger",
+		fieldType:   jen.Id("Logger"),
+		description: "WithLogger logs warnings, such as an unavailable optional dependency, and wag client logs to l. By default, warnings go to the standard logger.",
+	},
+}
+
+// needsInitOptions reports whether creating any of the dependency clients reads initOptions
+func needsInitOptions(depTasks []initTask) bool {
+	for _, t := range depTasks {
+		if t.usesOptions() || t.optional {
+			return true
+		}
+	}
+	return false
+}
+
+// initOptionsLines resolve NewLaunchConfig's options, if creating a dependency client reads them
+func initOptionsLines(depTasks []initTask) []jen.Code {
+	if !needsInitOptions(depTasks) {
+		return []jen.Code{}
+	}
+	return []jen.Code{jen.Id("o").Op(":=").Id("newInitOptions").Call(jen.Id("opts"))}
+}
+
+// emitInitOptions writes Logger, Option and the With* options NewLaunchConfig takes. withResource makes
+// the tracer provider newInitOptions creates use the generated Resource.
+func emitInitOptions(f *jen.File, withResource bool) {
+	f.ImportAlias("go.opentelemetry.io/otel/trace", "oteltrace")
+
+	f.Comment("Logger is satisfied by *log.Logger")
+	f.Type().Id("Logger").Interface(
+		jen.Id("Printf").Params(jen.Id("format").String(), jen.Id("v").Op("...").Interface()),
+	)
+
+	f.Comment("Option configures the observability of the dependency clients NewLaunchConfig creates")
+	f.Type().Id("Option").Func().Params(jen.Op("*").Id("initOptions"))
+
+	f.Comment("initOptions are set by Options")
+	f.Type().Id("initOptions").StructFunc(func(g *jen.Group) {
+		for _, opt := range initOptionSpecs {
+			g.Id(opt.field).Add(opt.fieldType)
+		}
+		g.Comment("traces is the tracer provider every dependency client traces with: tracerProvider, or else one")
+		g.Comment("created once from exporter")
+		g.Id("traces").Qual("go.opentelemetry.io/otel/trace", "TracerProvider")
+		g.Comment("loggerSet is whether WithLogger was passed, so wag clients log to logger")
+		g.Id("loggerSet").Bool()
+		g.Id("closers").Op("*").Id("closers")
+	})
+
+	for _, opt := range initOptionSpecs {
+		f.Comment(opt.description)
+		f.Func().Id(opt.name).Params(jen.Id(opt.param).Add(opt.fieldType)).Id("Option").Block(
+			jen.Return(jen.Func().Params(jen.Id("o").Op("*").Id("initOptions")).Block(
+				jen.Id("o").Dot(opt.field).Op("=").Id(opt.param),
+			)),
+		)
+	}
+
+	f.Comment("callerExporter is a WithSpanExporter exporter, which the caller shuts down rather than Close")
+	f.Type().Id("callerExporter").Struct(jen.Qual(sdkTracePath, "SpanExporter"))
+
+	f.Comment("Shutdown leaves the exporter running")
+	f.Func().Params(jen.Id("callerExporter")).Id("Shutdown").Params(jen.Qual("context", "Context")).Error().Block(
+		jen.Return(jen.Nil()),
+	)
+
+	f.Comment("newInitOptions applies opts to the defaults. The tracer provider it creates is shut down by Close.")
+	f.Func().Id("newInitOptions").Params(jen.Id("opts").Index().Id("Option")).Id("initOptions").Block(
+		jen.Id("o").Op(":=").Id("initOptions").Values(),
+		jen.For(jen.List(jen.Id("_"), jen.Id("opt")).Op(":=").Range().Id("opts")).Block(
+			jen.Id("opt").Call(jen.Op("&").Id("o")),
+		),
+		jen.Id("o").Dot("loggerSet").Op("=").Id("o").Dot("logger").Op("!=").Nil(),
+		jen.If(jen.Op("!").Id("o").Dot("loggerSet")).Block(
+			jen.Id("o").Dot("logger").Op("=").Qual("log", "Default").Call(),
+		),
+		jen.Id("o").Dot("closers").Op("=").Op("&").Id("closers").Values(),
+		jen.Id("o").Dot("traces").Op("=").Id("o").Dot("tracerProvider"),
+		jen.If(jen.Id("o").Dot("traces").Op("==").Nil()).Block(
+			jen.Var().Id("exp").Qual(sdkTracePath, "SpanExporter").Op("=").Qual(sdkTracePath+"/tracetest", "NewNoopExporter").Call(),
+			jen.If(jen.Id("o").Dot("exporter").Op("!=").Nil()).Block(
+				jen.Id("exp").Op("=").Id("callerExporter").Values(jen.Id("o").Dot("exporter")),
+			),
+			jen.Id("tp").Op(":=").Qual(sdkTracePath, "NewTracerProvider").CallFunc(func(g *jen.Group) {
+				g.Qual(sdkTracePath, "WithBatcher").Call(jen.Id("exp"))
+				if withResource {
+					g.Qual(sdkTracePath, "WithResource").Call(jen.Id("Resource").Call())
+				}
+			}),
+			addCloser(jen.Id("tp").Dot("Shutdown")),
+			jen.Id("o").Dot("traces").Op("=").Id("tp"),
+		),
+		jen.Return(jen.Id("o")),
+	)
+
+	f.Comment("spanExporterOptions are the options for InitLaunchConfig's exp")
+	f.Func().Id("spanExporterOptions").Params(jen.Id("exp").Op("*").Qual(sdkTracePath, "SpanExporter")).Index().Id("Option").Block(
+		jen.If(jen.Id("exp").Op("==").Nil()).Block(
+			jen.Return(jen.Nil()),
+		),
+		jen.Return(jen.Index().Id("Option").Values(jen.Id("WithSpanExporter").Call(jen.Op("*").Id("exp")))),
+	)
+}
+
+// otelOptionsLines collect the otelhttp or otelgrpc options for the shared tracer provider, and the meter
+// provider and propagators, if they are set
+func otelOptionsLines(pkg string) []jen.Code {
+	return []jen.Code{
+		jen.Id("otelOpts").Op(":=").Index().Qual(pkg, "Option").Values(jen.Qual(pkg, "WithTracerProvider").Call(jen.Id("o").Dot("traces"))),
+		jen.If(jen.Id("o").Dot("meterProvider").Op("!=").Nil()).Block(
+			jen.Id("otelOpts").Op("=").Append(jen.Id("otelOpts"), jen.Qual(pkg, "WithMeterProvider").Call(jen.Id("o").Dot("meterProvider"))),
+		),
+		jen.If(jen.Id("o").Dot("propagators").Op("!=").Nil()).Block(
+			jen.Id("otelOpts").Op("=").Append(jen.Id("otelOpts"), jen.Qual(pkg, "WithPropagators").Call(jen.Id("o").Dot("propagators"))),
+		),
+	}
+}
+
+// emitInstrumentHTTPClient writes instrumentHTTPClient and wagLogger, which wag client constructors use
+func emitInstrumentHTTPClient(f *jen.File) {
+	f.Comment("instrumentHTTPClient traces and meters c with o's tracer provider, and its meter provider and propagators, if they are set.")
+	f.Comment("It's the only instrumentation of wag clients, which clientconfig creates untraced.")
+	f.Func().Params(jen.Id("o").Id("initOptions")).Id("instrumentHTTPClient").Params(jen.Id("c").Op("*").Qual("net/http", "Client")).BlockFunc(func(g *jen.Group) {
+		for _, line := range otelOptionsLines(otelhttpPath) {
+			g.Add(line)
+		}
+		g.Id("c").Dot("Transport").Op("=").Qual(otelhttpPath, "NewTransport").Call(jen.Id("c").Dot("Transport"), jen.Id("otelOpts").Op("..."))
+	})
+
+	f.Comment("wagLogger logs a wag client's messages to the WithLogger logger")
+	f.Type().Id("wagLogger").Struct(jen.Id("l").Id("Logger"))
+
+	f.Func().Params(jen.Id("w").Id("wagLogger")).Id("Log").Params(
+		jen.Id("level").Qual(wagClientLoggerPath, "LogLevel"),
+		jen.Id("message").String(),
+		jen.Id("pairs").Map(jen.String()).Interface(),
+	).Block(
+		jen.Id("w").Dot("l").Dot("Printf").Call(jen.Lit("%v: %s %v"), jen.Id("level"), jen.Id("message"), jen.Id("pairs")),
+	)
+}
+
+// clientConstructorName names the generated function that creates a wag dependency's client
+// workflow-manager => newWorkflowManagerClient
+func clientConstructorName(dep string) string {
+	return "new" + toPublicVar(dep) + "Client"
+}
+
+// emitClientConstructor writes the function that creates a wag dependency's client from initOptions
+func emitClientConstructor(f *jen.File, t initTask) {
+	f.Comment(clientConstructorName(t.name) + " creates the " + t.name + " client")
+	f.Func().Id(clientConstructorName(t.name)).Params(jen.Id("o").Id("initOptions")).Params(t.varType, jen.Error()).BlockFunc(func(g *jen.Group) {
+		g.List(jen.Id("httpClient"), jen.Id("logger")).Op(":=").Add(t.clientconfigCall)
+		g.Id("o").Dot("instrumentHTTPClient").Call(jen.Id("httpClient"))
+		g.If(jen.Id("o").Dot("loggerSet")).Block(
+			jen.Id("logger").Op("=").Id("wagLogger").Values(jen.Id("o").Dot("logger")),
+		)
+		g.List(jen.Id("c"), jen.Err()).Op(":=").Add(t.constructorCall)
+		g.If(jen.Err().Op("!=").Nil()).Block(
+			jen.Return(jen.Nil(), jen.Err()),
+		)
+		g.Add(addCloser(jen.Func().Params(jen.Qual("context", "Context")).Error().Block(
+			jen.Id("httpClient").Dot("CloseIdleConnections").Call(),
+			jen.Return(jen.Nil()),
+		)))
+		for _, line := range configureLines("c", t) {
+			g.Add(line)
+		}
+		g.Return(jen.Id("c"), jen.Nil())
+	})
+}
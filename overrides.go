@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// majorVersionSuffix matches an import path's major version suffix, e.g. /v5
+var majorVersionSuffix = regexp.MustCompile(`/v([0-9]+)$`)
+
+// dependencyOverride changes how a wag dependency's client is imported and created
+type dependencyOverride struct {
+	// importPath is the client package's full import path
+	importPath string
+	// suffix replaces /gen-go/client after github.com/Clever/<dep>, if importPath is unset
+	suffix string
+	// constructor is called instead of NewFromDiscovery
+	constructor string
+	// tracingName is passed to the clientconfig function instead of the dependency's name
+	tracingName string
+}
+
+// parseOverrideDependencies parses the -d flag, dep1:replacementDep1,dep2:replacementDep2. Each
+// replacement is a path under github.com/Clever.
+func parseOverrideDependencies(overrideDependenciesString string, dependencies []string) (map[string]dependencyOverride, error) {
+	overrides := map[string]dependencyOverride{}
+	if overrideDependenciesString == "" {
+		return overrides, nil
+	}
+
+	for _, overrideRule := range strings.Split(overrideDependenciesString, ",") {
+		depReplacementArr := strings.Split(overrideRule, ":")
+		if len(depReplacementArr) != 2 || depReplacementArr[1] == "" {
+			return nil, fmt.Errorf("invalid formatting for the -d flag: %q", overrideRule)
+		}
+		if !contains(dependencies, depReplacementArr[0]) {
+			return nil, fmt.Errorf("%s is not a dependency specified in the provided yaml file", depReplacementArr[0])
+		}
+		overrides[depReplacementArr[0]] = dependencyOverride{importPath: cleverImportPath(depReplacementArr[1], "")}
+	}
+	return overrides, nil
+}
+
+// parseOverride parses an -override value, dep:key=value,key=value, where the keys are import,
+// suffix, constructor and tracingName
+func parseOverride(s string) (string, dependencyOverride, error) {
+	o := dependencyOverride{}
+	dep, settings, ok := strings.Cut(s, ":")
+	if !ok || dep == "" || settings == "" {
+		return "", o, fmt.Errorf("invalid -override %q, expected dep:key=value,...", s)
+	}
+	for _, setting := range strings.Split(settings, ",") {
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok || value == "" {
+			return "", o, fmt.Errorf("invalid -override %q: %q is not key=value", s, setting)
+		}
+		switch key {
+		case "import":
+			o.importPath = value
+		case "suffix":
+			o.suffix = value
+		case "constructor":
+			if !token.IsIdentifier(value) {
+				return "", o, fmt.Errorf("invalid -override %q: constructor %q is not a Go identifier", s, value)
+			}
+			o.constructor = value
+		case "tracingName":
+			o.tracingName = value
+		default:
+			return "", o, fmt.Errorf("invalid -override %q: unknown key %q, must be one of: import, suffix, constructor, tracingName", s, key)
+		}
+	}
+	if o.importPath != "" && o.suffix != "" {
+		return "", o, fmt.Errorf("invalid -override %q: import and suffix can't both be set", s)
+	}
+	return dep, o, nil
+}
+
+// parseOverrides parses the -d and -override flags, checking that each overridden dependency is
+// declared, is a wag dependency, and is overridden only once. A dependency's version is appended to
+// its overridden import path.
+func parseOverrides(opts options, deps []dependency) (map[string]dependencyOverride, error) {
+	dependencies := dependencyNames(deps)
+	overrides, err := parseOverrideDependencies(opts.overrideDependencies, dependencies)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range opts.overrides {
+		dep, o, err := parseOverride(s)
+		if err != nil {
+			return nil, err
+		}
+		if !contains(dependencies, dep) {
+			return nil, fmt.Errorf("%s is not a dependency specified in the provided yaml file", dep)
+		}
+		if _, ok := overrides[dep]; ok {
+			return nil, fmt.Errorf("%s is overridden more than once", dep)
+		}
+		overrides[dep] = o
+	}
+	for _, d := range deps {
+		o, ok := overrides[d.Name]
+		if !ok {
+			continue
+		}
+		if d.kind() != dependencyKindWag {
+			return nil, fmt.Errorf("%s has kind %s, but only wag dependencies can be overridden", d.Name, d.kind())
+		}
+		if o.importPath, err = versionedImportPath(o.importPath, d); err != nil {
+			return nil, err
+		}
+		overrides[d.Name] = o
+	}
+	return overrides, nil
+}
+
+// versionedImportPath appends d's version to an overridden import path, unless the path already ends
+// in it. A path that ends in a different major version is an error.
+func versionedImportPath(importPath string, d dependency) (string, error) {
+	if importPath == "" || d.Version < 2 {
+		return importPath, nil
+	}
+	version := strconv.Itoa(d.Version)
+	if m := majorVersionSuffix.FindStringSubmatch(importPath); m != nil {
+		if m[1] != version {
+			return "", fmt.Errorf("%s is version %s, but its import is overridden with %s", d.Name, version, importPath)
+		}
+		return importPath, nil
+	}
+	return importPath + "/v" + version, nil
+}
+
+// clientImportPath is the import path of a wag dependency's client package
+func clientImportPath(d dependency, overrides map[string]dependencyOverride) string {
+	o := overrides[d.Name]
+	if o.importPath != "" {
+		return o.importPath
+	}
+	suffix := wagClientSuffix
+	if o.suffix != "" {
+		suffix = o.suffix
+	}
+	if d.Version >= 2 {
+		suffix += "/v" + strconv.Itoa(d.Version)
+	}
+	return cleverImportPath(d.Name, suffix)
+}
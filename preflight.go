@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-yaml/yaml"
+)
+
+// requirement is a set of env vars the generated code reads at startup
+type requirement struct {
+	kind string
+	name string
+	// envVarSets are alternatives: the requirement is met once every env var in any one set is present
+	envVarSets [][]string
+	required   bool
+	// nonEmpty requirements aren't met by an env var that is set to ""
+	nonEmpty bool
+	// defaultValue, from values.yaml, meets the requirement when its env var is missing
+	defaultValue string
+}
+
+// preflightResult is the outcome of checking one requirement
+type preflightResult struct {
+	requirement
+	// missing are the absent env vars of the first set, reported when no set is complete
+	missing []string
+	// defaulted results are met by their defaultValue
+	defaulted bool
+}
+
+func (r preflightResult) ok() bool {
+	return len(r.missing) == 0
+}
+
+func (r preflightResult) status() string {
+	switch {
+	case r.defaulted:
+		return "default"
+	case r.ok():
+		return "ok"
+	case r.required:
+		return "MISSING"
+	default:
+		return "unset"
+	}
+}
+
+// requirements turns spec items into the env vars to check. S3 buckets collapse into a single
+// deploy env requirement, since that is all getS3NameByEnv reads. Kubernetes services always need the
+// deploy env: without it, CurrentDeployEnv().IsProduction() is false even in production.
+func requirements(items []specItem, kubernetes bool) []requirement {
+	reqs := []requirement{}
+	hasBuckets := false
+	for _, item := range items {
+		switch item.kind {
+		case specKindDependency, specKindExternalURL:
+			reqs = append(reqs, discoveryRequirement(item))
+		case specKindS3Bucket:
+			hasBuckets = true
+		default:
+			reqs = append(reqs, requirement{kind: item.kind, name: item.name, envVarSets: [][]string{{item.envVar}}, required: item.required, defaultValue: item.defaultValue})
+		}
+	}
+	if hasBuckets || kubernetes {
+		reqs = append(reqs, requirement{kind: "deployEnv", name: "deploy environment", envVarSets: [][]string{{"DEPLOY_ENV"}, {"_DEPLOY_ENV"}}, required: true, nonEmpty: true})
+	}
+	return reqs
+}
+
+// checkRequirements looks up every requirement's env vars
+func checkRequirements(reqs []requirement, lookup func(string) (string, bool)) []preflightResult {
+	results := []preflightResult{}
+	for _, req := range reqs {
+		var missing []string
+		for i, set := range req.envVarSets {
+			absent := []string{}
+			for _, envVar := range set {
+				v, ok := lookup(envVar)
+				switch {
+				case !ok:
+					absent = append(absent, envVar)
+				case req.nonEmpty && v == "":
+					absent = append(absent, envVar+" (empty)")
+				}
+			}
+			if len(absent) == 0 {
+				missing = nil
+				break
+			}
+			if i == 0 {
+				missing = absent
+			}
+		}
+		if missing != nil && req.defaultValue != "" {
+			results = append(results, preflightResult{requirement: req, defaulted: true})
+			continue
+		}
+		results = append(results, preflightResult{requirement: req, missing: missing})
+	}
+	return results
+}
+
+// parseEnvFile reads KEY=VALUE lines, ignoring blank lines, comments and a leading "export"
+func parseEnvFile(r io.Reader) (map[string]string, error) {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNumber)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		env[key] = value
+	}
+	return env, scanner.Err()
+}
+
+// parseSpec reads either YAML format into the spec items it declares
+func parseSpec(kubernetes bool, data []byte, skip map[string]bool) ([]specItem, error) {
+	if kubernetes {
+		t := ValuesYML{}
+		if err := yaml.Unmarshal(data, &t); err != nil {
+			return nil, err
+		}
+		return kubernetesSpec(t, skip), nil
+	}
+	t := LaunchYML{}
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	return fargateSpec(t, skip), nil
+}
+
+// describeEnvVarSets renders alternatives as "A, B or C, D"
+func describeEnvVarSets(sets [][]string) string {
+	described := []string{}
+	for _, set := range sets {
+		described = append(described, strings.Join(set, ", "))
+	}
+	return strings.Join(described, " or ")
+}
+
+func writePreflightTable(output io.Writer, results []preflightResult) error {
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tKIND\tNAME\tENV VARS")
+	for _, r := range results {
+		envVars := describeEnvVarSets(r.envVarSets)
+		if !r.ok() {
+			envVars = "missing " + strings.Join(r.missing, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.status(), r.kind, r.name, envVars)
+	}
+	return w.Flush()
+}
+
+// runPreflight implements `launch-gen preflight`. It returns an error if a required env var is
+// missing, after printing the full table.
+func runPreflight(args []string, output io.Writer) error {
+	fs := flag.NewFlagSet("preflight", flag.ContinueOnError)
+	kubernetes := fs.Bool("kubernetes", false, "check a clever-application values.yaml (Kubernetes) instead of launch.yml (Fargate)")
+	envFile := fs.String("env-file", "", "optional env file to check instead of the current process environment")
+	skipDependencies := map[string]bool{}
+	fs.Func("skip-dependency", "Dependency to skip checking. Can be added multiple times", func(s string) error {
+		skipDependencies[s] = true
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: launch-gen preflight [-kubernetes] [-env-file <file>] <file>")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	items, err := parseSpec(*kubernetes, data, skipDependencies)
+	if err != nil {
+		return err
+	}
+
+	lookup := os.LookupEnv
+	if *envFile != "" {
+		f, err := os.Open(*envFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		env, err := parseEnvFile(f)
+		if err != nil {
+			return fmt.Errorf("error reading '%s': %s", *envFile, err)
+		}
+		lookup = func(s string) (string, bool) {
+			v, ok := env[s]
+			return v, ok
+		}
+	}
+
+	results := checkRequirements(requirements(items, *kubernetes), lookup)
+	if err := writePreflightTable(output, results); err != nil {
+		return err
+	}
+	if message := missingDiscoveryMessage(results); message != "" {
+		fmt.Fprintln(output)
+		fmt.Fprintln(output, message)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.required && !r.ok() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("preflight failed: %d required item(s) missing", failed)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/dave/jennifer/jen"
+)
+
+// appMetadata identifies the app a YAML file configures
+type appMetadata struct {
+	Name string `yaml:"name"`
+}
+
+// resourceAttribute is an OTel resource attribute, set if its string value isn't empty
+type resourceAttribute struct {
+	key   string
+	value *jen.Statement
+}
+
+// envVarAttribute reads an attribute from an env var
+func envVarAttribute(key, envVar string) resourceAttribute {
+	return resourceAttribute{key: key, value: jen.Qual("os", "Getenv").Call(jen.Lit(envVar))}
+}
+
+var fargateResourceAttributes = []resourceAttribute{
+	{key: "deployment.environment", value: jen.String().Call(currentDeployEnv())},
+}
+
+// kubernetesResourceAttributes add pod metadata, from the same env vars as the runtime section
+var kubernetesResourceAttributes = append(fargateResourceAttributes, []resourceAttribute{
+	envVarAttribute("k8s.pod.name", "POD_NAME"),
+	envVarAttribute("k8s.namespace.name", "POD_NAMESPACE"),
+}...)
+
+// emitResource writes ServiceName and Resource, if the app's name is set
+func emitResource(f *jen.File, app appMetadata, attrs []resourceAttribute) {
+	if app.Name == "" {
+		return
+	}
+
+	f.Comment("ServiceName is the app's name, from app.name")
+	f.Const().Id("ServiceName").Op("=").Lit(app.Name)
+
+	f.Comment("Resource identifies the service in telemetry, by its name, deploy environment and where it runs.")
+	f.Comment("Tracer providers that launch-gen creates use it.")
+	f.Func().Id("Resource").Params().Op("*").Qual("go.opentelemetry.io/otel/sdk/resource", "Resource").BlockFunc(func(g *jen.Group) {
+		g.Id("attrs").Op(":=").Index().Qual("go.opentelemetry.io/otel/attribute", "KeyValue").Values(
+			jen.Qual("go.opentelemetry.io/otel/attribute", "String").Call(jen.Lit("service.name"), jen.Id("ServiceName")),
+		)
+		for _, a := range attrs {
+			g.If(jen.Id("v").Op(":=").Add(a.value.Clone()), jen.Id("v").Op("!=").Lit("")).Block(
+				jen.Id("attrs").Op("=").Append(jen.Id("attrs"), jen.Qual("go.opentelemetry.io/otel/attribute", "String").Call(jen.Lit(a.key), jen.Id("v"))),
+			)
+		}
+		g.Return(jen.Qual("go.opentelemetry.io/otel/sdk/resource", "NewSchemaless").Call(jen.Id("attrs").Op("...")))
+	})
+}
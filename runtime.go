@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// runtimeField is a runtime: key, and the downward API env var the clever-application chart sets for it
+type runtimeField struct {
+	key         string
+	field       string
+	envVar      string
+	description string
+	// entryDocs are from the runtime: entry. The chart sets the env vars, so a deprecated key isn't
+	// warned about at startup.
+	entryDocs
+}
+
+var runtimeFields = []runtimeField{
+	{key: "podName", field: "PodName", envVar: "POD_NAME", description: "the pod's name"},
+	{key: "namespace", field: "Namespace", envVar: "POD_NAMESPACE", description: "the pod's namespace"},
+	{key: "nodeName", field: "NodeName", envVar: "NODE_NAME", description: "the name of the node the pod runs on"},
+	{key: "podIP", field: "PodIP", envVar: "POD_IP", description: "the pod's IP address"},
+}
+
+// runtimeSection is a values.yaml's runtime: keys. It is nil if the section is absent.
+type runtimeSection []runtimeField
+
+// UnmarshalYAML looks up each key's runtimeField
+func (r *runtimeSection) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	keys := []namedEntry{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	fields, err := runtimeFieldsFor(keys)
+	if err != nil {
+		return err
+	}
+	*r = fields
+	return nil
+}
+
+// runtimeFieldsFor looks up runtime: keys, with their docs
+func runtimeFieldsFor(keys []namedEntry) ([]runtimeField, error) {
+	fields := []runtimeField{}
+	for _, key := range keys {
+		found := false
+		for _, rf := range runtimeFields {
+			if rf.key == key.Name {
+				rf.entryDocs = key.entryDocs
+				fields = append(fields, rf)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := []string{}
+			for _, rf := range runtimeFields {
+				known = append(known, rf.key)
+			}
+			return nil, fmt.Errorf("unknown runtime field %q, must be one of %s", key.Name, strings.Join(known, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// runtimeSpecs describes the runtime env vars. They're never required, as they aren't set locally.
+func runtimeSpecs(fields []runtimeField) []specItem {
+	items := []specItem{}
+	for _, rf := range fields {
+		item := specItem{
+			kind:        specKindEnvVar,
+			name:        rf.envVar,
+			envVar:      rf.envVar,
+			description: "Kubernetes downward API: " + rf.description,
+			deprecated:  rf.Deprecated,
+			injected:    true,
+			value:       jen.Id("c").Dot("Runtime").Dot(rf.field),
+		}
+		if rf.Description != "" {
+			item.description = rf.Description
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// emitRuntime writes the Runtime struct, and returns the dict that populates it
+func emitRuntime(f *jen.File, fields []runtimeField, opts options) jen.Dict {
+	f.Comment("Runtime has the pod's metadata, from the downward API env vars the clever-application chart sets.")
+	f.Comment("They're empty outside Kubernetes.")
+	f.Type().Id("Runtime").StructFunc(func(g *jen.Group) {
+		for _, rf := range fields {
+			for _, c := range rf.comments() {
+				g.Add(c)
+			}
+			g.Id(rf.field).String()
+		}
+		g.Id("kubernetes").Bool()
+		g.Id("deployEnv").Id("DeployEnv")
+	})
+
+	f.Comment("IsKubernetes reports whether the service is running in a Kubernetes pod")
+	f.Func().Params(jen.Id("r").Id("Runtime")).Id("IsKubernetes").Params().Bool().Block(
+		jen.Return(jen.Id("r").Dot("kubernetes")),
+	)
+
+	f.Comment("IsLocal reports whether the deploy environment is local")
+	f.Func().Params(jen.Id("r").Id("Runtime")).Id("IsLocal").Params().Bool().Block(
+		jen.Return(jen.Id("r").Dot("deployEnv").Dot("IsLocal").Call()),
+	)
+
+	dict := jen.Dict{
+		jen.Id("kubernetes"): jen.Qual("os", "Getenv").Call(jen.Lit("KUBERNETES_SERVICE_HOST")).Op("!=").Lit(""),
+		jen.Id("deployEnv"):  currentDeployEnv(),
+	}
+	for _, rf := range fields {
+		dict[jen.Id(rf.field)] = optionalEnvVarValue(rf.envVar, opts)
+	}
+	return dict
+}
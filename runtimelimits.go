@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// containerResources are a values.yaml's resources.requests and resources.limits
+type containerResources struct {
+	Requests resourceList `yaml:"requests"`
+	Limits   resourceList `yaml:"limits"`
+}
+
+// resourceList holds Kubernetes quantities, e.g. cpu: 100m, memory: 512Mi
+type resourceList struct {
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+// quantitySuffixes are the Kubernetes binary and decimal SI suffixes
+var quantitySuffixes = map[string]*big.Rat{
+	"Ki": new(big.Rat).SetInt64(1 << 10),
+	"Mi": new(big.Rat).SetInt64(1 << 20),
+	"Gi": new(big.Rat).SetInt64(1 << 30),
+	"Ti": new(big.Rat).SetInt64(1 << 40),
+	"Pi": new(big.Rat).SetInt64(1 << 50),
+	"Ei": new(big.Rat).SetInt64(1 << 60),
+	"n":  big.NewRat(1, 1e9),
+	"u":  big.NewRat(1, 1e6),
+	"m":  big.NewRat(1, 1e3),
+	"":   big.NewRat(1, 1),
+	"k":  big.NewRat(1e3, 1),
+	"M":  big.NewRat(1e6, 1),
+	"G":  big.NewRat(1e9, 1),
+	"T":  big.NewRat(1e12, 1),
+	"P":  big.NewRat(1e15, 1),
+	"E":  big.NewRat(1e18, 1),
+}
+
+// parseQuantity parses a non-negative Kubernetes quantity, e.g. 100m, 1.5Gi or 1e3
+func parseQuantity(s string) (*big.Rat, error) {
+	number := strings.TrimLeft(s, "+")
+	end := strings.IndexFunc(number, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end == -1 {
+		end = len(number)
+	}
+	suffix := number[end:]
+	number = number[:end]
+	if number == "" || strings.Count(number, ".") > 1 || number == "." {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	q, ok := new(big.Rat).SetString(number)
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+
+	if len(suffix) > 1 && (suffix[0] == 'e' || suffix[0] == 'E') {
+		exp, err := strconv.Atoi(suffix[1:])
+		if err != nil || exp > 18 || exp < -9 {
+			return nil, fmt.Errorf("invalid quantity %q: bad exponent", s)
+		}
+		pow := int64(exp)
+		if exp < 0 {
+			pow = -pow
+		}
+		scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(pow), nil))
+		if exp < 0 {
+			scale.Inv(scale)
+		}
+		return q.Mul(q, scale), nil
+	}
+	scale, ok := quantitySuffixes[suffix]
+	if !ok {
+		return nil, fmt.Errorf("invalid quantity %q: unknown suffix %q", s, suffix)
+	}
+	return q.Mul(q, scale), nil
+}
+
+// ceilInt64 rounds q up to an int64, as Kubernetes rounds quantities up
+func ceilInt64(q *big.Rat) (int64, error) {
+	n, rem := new(big.Int).QuoRem(q.Num(), q.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		n.Add(n, big.NewInt(1))
+	}
+	if !n.IsInt64() {
+		return 0, fmt.Errorf("quantity %s is too large", q.FloatString(0))
+	}
+	return n.Int64(), nil
+}
+
+// runtimeLimits are a container's CPU, in millicores, and memory, in bytes: the limit if it is set,
+// or else the request. They're 0 if neither is set.
+func runtimeLimits(r containerResources) (cpuMillis, memoryBytes int64, err error) {
+	quantity := func(limit, request string, scale int64) (int64, error) {
+		s := limit
+		if s == "" {
+			s = request
+		}
+		if s == "" {
+			return 0, nil
+		}
+		q, err := parseQuantity(s)
+		if err != nil {
+			return 0, err
+		}
+		return ceilInt64(q.Mul(q, new(big.Rat).SetInt64(scale)))
+	}
+	if cpuMillis, err = quantity(r.Limits.CPU, r.Requests.CPU, 1000); err != nil {
+		return 0, 0, fmt.Errorf("resources cpu: %s", err)
+	}
+	if memoryBytes, err = quantity(r.Limits.Memory, r.Requests.Memory, 1); err != nil {
+		return 0, 0, fmt.Errorf("resources memory: %s", err)
+	}
+	return cpuMillis, memoryBytes, nil
+}
+
+// emitRuntimeLimits writes CPULimitMillis, MemoryLimitBytes and ApplyRuntimeLimits
+func emitRuntimeLimits(f *jen.File, r containerResources) error {
+	cpuMillis, memoryBytes, err := runtimeLimits(r)
+	if err != nil {
+		return err
+	}
+
+	f.Comment("CPULimitMillis is the container's CPU in millicores, from resources.limits.cpu or else resources.requests.cpu, or 0")
+	f.Const().Id("CPULimitMillis").Op("=").Lit(int(cpuMillis))
+
+	f.Comment("MemoryLimitBytes is the container's memory in bytes, from resources.limits.memory or else resources.requests.memory, or 0")
+	f.Const().Id("MemoryLimitBytes").Op("=").Lit(int(memoryBytes))
+
+	f.Comment("ApplyRuntimeLimits sets GOMAXPROCS from CPULimitMillis, rounded up, and GOMEMLIMIT to 90% of MemoryLimitBytes,")
+	f.Comment("leaving room for memory outside the Go heap. The GOMAXPROCS and GOMEMLIMIT env vars take precedence.")
+	f.Comment("Call it at the start of main.")
+	f.Func().Id("ApplyRuntimeLimits").Params().Block(
+		jen.If(jen.List(jen.Id("_"), jen.Id("ok")).Op(":=").Qual("os", "LookupEnv").Call(jen.Lit("GOMAXPROCS")), jen.Op("!").Id("ok").Op("&&").Id("CPULimitMillis").Op(">").Lit(0)).Block(
+			jen.Qual("runtime", "GOMAXPROCS").Call(jen.Parens(jen.Id("CPULimitMillis").Op("+").Lit(999)).Op("/").Lit(1000)),
+		),
+		jen.If(jen.List(jen.Id("_"), jen.Id("ok")).Op(":=").Qual("os", "LookupEnv").Call(jen.Lit("GOMEMLIMIT")), jen.Op("!").Id("ok").Op("&&").Id("MemoryLimitBytes").Op(">").Lit(0)).Block(
+			jen.Qual("runtime/debug", "SetMemoryLimit").Call(jen.Id("MemoryLimitBytes").Op("/").Lit(10).Op("*").Lit(9)),
+		),
+	)
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dave/jennifer/jen"
+)
+
+// spec kinds, as they appear in the generated LaunchSpec
+const (
+	specKindEnvVar      = "envVar"
+	specKindDependency  = "dependency"
+	specKindS3Bucket    = "s3Bucket"
+	specKindExternalURL = "externalUrl"
+)
+
+// specItem is one piece of configuration declared in the YAML
+type specItem struct {
+	kind        string
+	name        string
+	envVar      string
+	required    bool
+	secret      bool
+	description string
+	// deprecated is why the YAML entry is deprecated, if it is
+	deprecated string
+	// injected env vars are set by the platform, such as the downward API, rather than by the service's config
+	injected bool
+	// defaultValue is what .env.example suggests, and what requireEnvVar falls back to
+	defaultValue string
+	// exposes are the discovery exposes a dependency is found through, in the order they are tried
+	exposes []string
+	// value is the expression, relative to a LaunchConfig `c`, that holds the resolved value
+	value *jen.Statement
+}
+
+var secretEnvVarMarkers = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL"}
+
+// looksSecret reports whether an env var name suggests its value should not be printed
+func looksSecret(envVar string) bool {
+	upper := strings.ToUpper(envVar)
+	for _, marker := range secretEnvVarMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// discoveryEnvVarPattern describes the env vars discovery-go reads for a dependency's expose
+func discoveryEnvVarPattern(dep, expose string) string {
+	return "SERVICE_" + toEnvVarName(dep) + "_" + toEnvVarName(expose) + "_{PROTO,HOST,PORT}"
+}
+
+func envVarSpec(name string, required, secret bool) specItem {
+	return specItem{
+		kind:     specKindEnvVar,
+		name:     name,
+		envVar:   name,
+		required: required,
+		secret:   secret || looksSecret(name),
+		value:    jen.Id("c").Dot("Env").Dot(toPublicVar(name)),
+	}
+}
+
+func dependencySpecs(deps []dependency, skip map[string]bool) []specItem {
+	items := []specItem{}
+	for _, d := range deps {
+		if _, ok := skip[d.Name]; ok {
+			continue
+		}
+		items = append(items, specItem{
+			kind:        specKindDependency,
+			name:        d.Name,
+			envVar:      discoveryEnvVarPattern(d.Name, dependencyExposes[d.kind()][0]),
+			required:    !d.Optional,
+			description: dependencyDescriptions[d.kind()] + d.Name,
+			deprecated:  d.Deprecated,
+			exposes:     dependencyExposes[d.kind()],
+			value:       jen.Id("dependencyState").Call(jen.Id("c").Dot("Deps").Dot(toPublicVar(d.Name)).Op("!=").Nil()),
+		})
+	}
+	return items
+}
+
+func externalURLSpec(e namedEntry) specItem {
+	item := specItem{
+		kind:        specKindExternalURL,
+		name:        e.Name,
+		envVar:      "EXTERNAL_URL_" + toEnvVarName(e.Name),
+		required:    true,
+		description: "external URL for " + e.Name,
+		deprecated:  e.Deprecated,
+		value:       jen.Id("c").Dot("ExternalUrlUsage").Dot(toPublicVar(e.Name)),
+	}
+	if e.Description != "" {
+		item.description = e.Description
+	}
+	return item
+}
+
+// emitLaunchSpec writes LaunchSpec plus the DebugHandler and LogSummary helpers that render it
+func emitLaunchSpec(f *jen.File, items []specItem, opts options) {
+	f.Comment("SpecItem describes one piece of configuration the service declares")
+	f.Type().Id("SpecItem").Struct(
+		jen.Id("Kind").String().Tag(map[string]string{"json": "kind"}),
+		jen.Id("Name").String().Tag(map[string]string{"json": "name"}),
+		jen.Id("EnvVar").String().Tag(map[string]string{"json": "envVar"}),
+		jen.Id("Required").Bool().Tag(map[string]string{"json": "required"}),
+		jen.Id("Secret").Bool().Tag(map[string]string{"json": "secret"}),
+		jen.Id("Description").String().Tag(map[string]string{"json": "description"}),
+		jen.Id("Deprecated").String().Tag(map[string]string{"json": "deprecated,omitempty"}),
+	)
+
+	specValues := []jen.Code{}
+	resolvedValues := []jen.Code{}
+	hasSecrets, hasDependencies := false, false
+	for _, item := range items {
+		hasSecrets = hasSecrets || item.secret
+		hasDependencies = hasDependencies || (item.kind == specKindDependency && !opts.lazy)
+		values := jen.Dict{
+			jen.Id("Kind"):        jen.Lit(item.kind),
+			jen.Id("Name"):        jen.Lit(item.name),
+			jen.Id("EnvVar"):      jen.Lit(item.envVar),
+			jen.Id("Required"):    jen.Lit(item.required),
+			jen.Id("Secret"):      jen.Lit(item.secret),
+			jen.Id("Description"): jen.Lit(item.description),
+		}
+		if item.deprecated != "" {
+			values[jen.Id("Deprecated")] = jen.Lit(item.deprecated)
+		}
+		specValues = append(specValues, jen.Values(values))
+		if opts.lazy && item.kind == specKindDependency {
+			item.value = jen.Lit("created on first use")
+		}
+		if item.secret {
+			resolvedValues = append(resolvedValues, jen.Id("redacted").Call(item.value))
+		} else {
+			resolvedValues = append(resolvedValues, item.value)
+		}
+	}
+	f.Comment("LaunchSpec lists the env vars, dependencies, buckets and external URLs the service declares")
+	f.Var().Id("LaunchSpec").Op("=").Index().Id("SpecItem").ValuesFunc(func(g *jen.Group) {
+		for _, v := range specValues {
+			g.Line().Add(v)
+		}
+		if len(specValues) > 0 {
+			g.Line()
+		}
+	})
+
+	resolvedFields := []jen.Code{
+		jen.Id("SpecItem"),
+		jen.Id("Value").String().Tag(map[string]string{"json": "value"}),
+	}
+	resolvedDict := jen.Dict{
+		jen.Id("SpecItem"): jen.Id("s"),
+		jen.Id("Value"):    jen.Id("values").Index(jen.Id("i")),
+	}
+	logSummary := jen.Id("logger").Dot("Printf").Call(jen.Lit("launch config: %s %s = %q"), jen.Id("item").Dot("Kind"), jen.Id("item").Dot("Name"), jen.Id("item").Dot("Value"))
+	if opts.flags {
+		resolvedFields = append(resolvedFields, jen.Comment("Source is where an env var's value came from, as reported by ValueSource"), jen.Id("Source").String().Tag(map[string]string{"json": "source,omitempty"}))
+		resolvedDict[jen.Id("Source")] = jen.Id("ValueSource").Call(jen.Id("s").Dot("EnvVar"))
+		logSummary = jen.Id("logger").Dot("Printf").Call(jen.Lit("launch config: %s %s = %q (%s)"), jen.Id("item").Dot("Kind"), jen.Id("item").Dot("Name"), jen.Id("item").Dot("Value"), jen.Id("item").Dot("Source"))
+	}
+
+	f.Comment("ResolvedItem pairs a SpecItem with the value it resolved to at startup")
+	f.Type().Id("ResolvedItem").Struct(resolvedFields...)
+
+	f.Comment("Resolved returns LaunchSpec alongside the resolved values, with secrets redacted")
+	f.Func().Params(jen.Id("c").Id("LaunchConfig")).Id("Resolved").Params().Index().Id("ResolvedItem").Block(
+		jen.Id("values").Op(":=").Index().String().ValuesFunc(func(g *jen.Group) {
+			for _, v := range resolvedValues {
+				g.Line().Add(v)
+			}
+			if len(resolvedValues) > 0 {
+				g.Line()
+			}
+		}),
+		jen.Id("items").Op(":=").Make(jen.Index().Id("ResolvedItem"), jen.Len(jen.Id("LaunchSpec"))),
+		jen.For(jen.List(jen.Id("i"), jen.Id("s")).Op(":=").Range().Id("LaunchSpec")).Block(
+			jen.Id("items").Index(jen.Id("i")).Op("=").Id("ResolvedItem").Values(resolvedDict),
+		),
+		jen.Return(jen.Id("items")),
+	)
+
+	f.Comment("DebugHandler serves the resolved non-secret configuration as JSON")
+	f.Func().Params(jen.Id("c").Id("LaunchConfig")).Id("DebugHandler").Params().Qual("net/http", "Handler").Block(
+		jen.Return(jen.Qual("net/http", "HandlerFunc").Call(
+			jen.Func().Params(jen.Id("w").Qual("net/http", "ResponseWriter"), jen.Id("r").Op("*").Qual("net/http", "Request")).Block(
+				jen.Id("w").Dot("Header").Call().Dot("Set").Call(jen.Lit("Content-Type"), jen.Lit("application/json")),
+				jen.If(
+					jen.Err().Op(":=").Qual("encoding/json", "NewEncoder").Call(jen.Id("w")).Dot("Encode").Call(jen.Id("c").Dot("Resolved").Call()),
+					jen.Err().Op("!=").Nil(),
+				).Block(
+					jen.Qual("net/http", "Error").Call(jen.Id("w"), jen.Err().Dot("Error").Call(), jen.Qual("net/http", "StatusInternalServerError")),
+				),
+			),
+		)),
+	)
+
+	f.Comment("LogSummary logs the resolved non-secret configuration, one line per item")
+	f.Func().Params(jen.Id("c").Id("LaunchConfig")).Id("LogSummary").Params(jen.Id("logger").Id("Logger")).Block(
+		jen.For(jen.List(jen.Id("_"), jen.Id("item")).Op(":=").Range().Id("c").Dot("Resolved").Call()).Block(
+			logSummary,
+		),
+	)
+
+	if hasSecrets {
+		f.Comment("redacted hides a secret value while still showing whether it was set")
+		f.Func().Id("redacted").Params(jen.Id("s").String()).String().Block(
+			jen.If(jen.Id("s").Op("==").Lit("")).Block(jen.Return(jen.Lit(""))),
+			jen.Return(jen.Lit("<redacted>")),
+		)
+	}
+
+	if hasDependencies {
+		f.Comment("dependencyState describes whether a dependency client was created")
+		f.Func().Id("dependencyState").Params(jen.Id("initialized").Bool()).String().Block(
+			jen.If(jen.Op("!").Id("initialized")).Block(jen.Return(jen.Lit("uninitialized"))),
+			jen.Return(jen.Lit("initialized")),
+		)
+	}
+}